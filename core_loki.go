@@ -0,0 +1,177 @@
+package rklogger
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// LokiLevelLabel is label key of entry level added by LokiCore
+	LokiLevelLabel = "level"
+	// LokiLoggerLabel is label key of logger name added by LokiCore
+	LokiLoggerLabel = "logger"
+)
+
+// LokiCoreOption options for LokiCore
+type LokiCoreOption func(core *LokiCore)
+
+// WithLokiCoreLabelFields promote fields with keys to loki stream labels, invalid label names are sanitized
+func WithLokiCoreLabelFields(keys ...string) LokiCoreOption {
+	return func(core *LokiCore) {
+		for i := range keys {
+			if len(keys[i]) > 0 {
+				core.labelKeys[keys[i]] = struct{}{}
+			}
+		}
+	}
+}
+
+// WithLokiCoreStructuredMetadata send fields which are not labels as structured metadata instead of in log line,
+// structured metadata is supported since loki 3.0
+func WithLokiCoreStructuredMetadata(enabled bool) LokiCoreOption {
+	return func(core *LokiCore) {
+		core.structuredMetadata = enabled
+	}
+}
+
+// NewLokiCore create zapcore.Core which encodes entries with encoder and writes them into LokiSyncer,
+// level and logger name of entry are always added as labels
+func NewLokiCore(syncer *LokiSyncer, encoder zapcore.Encoder, enabler zapcore.LevelEnabler, opts ...LokiCoreOption) *LokiCore {
+	core := &LokiCore{
+		LevelEnabler: enabler,
+		syncer:       syncer,
+		encoder:      encoder,
+		labelKeys:    map[string]struct{}{},
+		fields:       []zapcore.Field{},
+	}
+
+	for i := range opts {
+		opts[i](core)
+	}
+
+	return core
+}
+
+// LokiCore is zapcore.Core which maps entry level, logger name and fields to loki labels and structured metadata
+type LokiCore struct {
+	zapcore.LevelEnabler
+	syncer             *LokiSyncer
+	encoder            zapcore.Encoder
+	labelKeys          map[string]struct{}
+	structuredMetadata bool
+	tenantKey          string
+	fields             []zapcore.Field
+}
+
+// ************* Implementation of zapcore.Core *************
+
+// With returns a copy of core with fields added
+func (core *LokiCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *core
+	clone.fields = make([]zapcore.Field, 0, len(core.fields)+len(fields))
+	clone.fields = append(clone.fields, core.fields...)
+	clone.fields = append(clone.fields, fields...)
+
+	return &clone
+}
+
+// Check adds core to checked entry if level is enabled
+func (core *LokiCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if core.Enabled(ent.Level) {
+		return ce.AddCore(ent, core)
+	}
+
+	return ce
+}
+
+// Write splits fields into labels, structured metadata and line, then add it to LokiSyncer
+func (core *LokiCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	labels := map[string]string{
+		LokiLevelLabel: ent.Level.String(),
+	}
+	if len(ent.LoggerName) > 0 {
+		labels[LokiLoggerLabel] = ent.LoggerName
+	}
+
+	var metadata map[string]string
+	var tenant string
+	lineFields := make([]zapcore.Field, 0, len(core.fields)+len(fields))
+
+	all := append(core.fields[:len(core.fields):len(core.fields)], fields...)
+	for i := range all {
+		field := all[i]
+
+		if len(core.tenantKey) > 0 && field.Key == core.tenantKey {
+			tenant = lokiFieldString(field)
+			continue
+		}
+
+		if _, ok := core.labelKeys[field.Key]; ok {
+			labels[field.Key] = lokiFieldString(field)
+			continue
+		}
+
+		if core.structuredMetadata && field.Type != zapcore.SkipType {
+			if metadata == nil {
+				metadata = map[string]string{}
+			}
+			metadata[field.Key] = lokiFieldString(field)
+			continue
+		}
+
+		lineFields = append(lineFields, field)
+	}
+
+	buf, err := core.encoder.EncodeEntry(ent, lineFields)
+	if err != nil {
+		return err
+	}
+
+	// entry created without time, like zapcore.Entry{} written by hand
+	ts := ent.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	core.syncer.add(&lokiValue{
+		Timestamp: ts,
+		Line:      buf.String(),
+		Labels:    labels,
+		Metadata:  metadata,
+		Tenant:    tenant,
+	})
+	buf.Free()
+
+	// like ioCore of zap, flush before process exits with Panic or Fatal
+	if ent.Level > zapcore.ErrorLevel {
+		return core.Sync()
+	}
+
+	return nil
+}
+
+// Sync flushes LokiSyncer
+func (core *LokiCore) Sync() error {
+	return core.syncer.Sync()
+}
+
+// Convert value of field to string, non string values are marshalled as json
+func lokiFieldString(field zapcore.Field) string {
+	enc := zapcore.NewMapObjectEncoder()
+	field.AddTo(enc)
+
+	switch v := enc.Fields[field.Key].(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		if bytes, err := json.Marshal(v); err == nil {
+			return string(bytes)
+		}
+		return fmt.Sprint(v)
+	}
+}
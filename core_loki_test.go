@@ -0,0 +1,111 @@
+package rklogger
+
+import (
+	"encoding/json"
+	"github.com/rookie-ninja/rk-logger/lokitest"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"testing"
+	"time"
+)
+
+func newLokiCoreForTest(opts ...LokiCoreOption) (*LokiSyncer, *zap.Logger) {
+	syncer := NewLokiSyncer()
+	encoder := zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg"})
+	return syncer, zap.New(NewLokiCore(syncer, encoder, zapcore.InfoLevel, opts...))
+}
+
+func TestNewLokiCore(t *testing.T) {
+	core := NewLokiCore(NewLokiSyncer(), zapcore.NewJSONEncoder(zapcore.EncoderConfig{}), zapcore.InfoLevel,
+		WithLokiCoreLabelFields("app", "invalid-key"),
+		WithLokiCoreStructuredMetadata(true))
+
+	assert.Len(t, core.labelKeys, 2)
+	assert.Contains(t, core.labelKeys, "app")
+	assert.Contains(t, core.labelKeys, "invalid-key")
+	assert.True(t, core.structuredMetadata)
+	assert.True(t, core.Enabled(zapcore.InfoLevel))
+	assert.False(t, core.Enabled(zapcore.DebugLevel))
+}
+
+func TestLokiCore_Write(t *testing.T) {
+	syncer, logger := newLokiCoreForTest(WithLokiCoreLabelFields("app"))
+
+	logger.Named("ut-logger").With(zap.String("app", "ut-app")).Info("ut-msg", zap.Int("count", 1))
+	logger.Debug("disabled")
+
+	values := syncer.buffer.snapshotAndClear()
+	assert.Len(t, values, 1)
+	assert.Equal(t, map[string]string{"level": "info", "logger": "ut-logger", "app": "ut-app"}, values[0].Labels)
+	assert.Nil(t, values[0].Metadata)
+	assert.Equal(t, `{"msg":"ut-msg","count":1}`+"\n", values[0].Line)
+	assert.False(t, values[0].Timestamp.IsZero())
+}
+
+func TestLokiCore_Write_WithStructuredMetadata(t *testing.T) {
+	syncer, logger := newLokiCoreForTest(WithLokiCoreStructuredMetadata(true))
+
+	logger.Warn("ut-msg", zap.String("traceId", "ut-trace"), zap.Strings("tags", []string{"a", "b"}))
+
+	values := syncer.buffer.snapshotAndClear()
+	assert.Len(t, values, 1)
+	assert.Equal(t, map[string]string{"level": "warn"}, values[0].Labels)
+	assert.Equal(t, map[string]string{"traceId": "ut-trace", "tags": `["a","b"]`}, values[0].Metadata)
+	assert.Equal(t, `{"msg":"ut-msg"}`+"\n", values[0].Line)
+}
+
+func TestLokiCore_Write_WithFatal(t *testing.T) {
+	server := lokitest.NewServer()
+	defer server.Close()
+
+	syncer := NewLokiSyncer(WithLokiAddr(server.Addr()), WithLokiMaxBatchWaitMs(time.Hour))
+	core := NewLokiCore(syncer, zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg"}), zapcore.InfoLevel)
+
+	// error is buffered
+	assert.Nil(t, core.Write(zapcore.Entry{Level: zapcore.ErrorLevel, Message: "ut-error"}, nil))
+	assert.Empty(t, server.Lines())
+
+	// fatal flushes buffer before process exits
+	assert.Nil(t, core.Write(zapcore.Entry{Level: zapcore.FatalLevel, Message: "ut-fatal"}, nil))
+	assert.Equal(t, []string{`{"msg":"ut-error"}` + "\n", `{"msg":"ut-fatal"}` + "\n"}, server.Lines())
+}
+
+func TestLokiCore_With(t *testing.T) {
+	syncer, logger := newLokiCoreForTest(WithLokiCoreLabelFields("app"))
+
+	// fields of parent should not be affected by child
+	parent := logger.With(zap.String("app", "parent"))
+	parent.With(zap.String("app", "child")).Info("child")
+	parent.Info("parent")
+
+	values := syncer.buffer.snapshotAndClear()
+	assert.Equal(t, "child", values[0].Labels["app"])
+	assert.Equal(t, "parent", values[1].Labels["app"])
+}
+
+func TestLokiCore_Sync(t *testing.T) {
+	defer assertNotPanic(t)
+
+	_, logger := newLokiCoreForTest()
+	assert.Nil(t, logger.Sync())
+}
+
+func TestLokiValue_MarshalJSON(t *testing.T) {
+	value := &lokiValue{Timestamp: time.Unix(0, 1), Line: "ut-line"}
+	bytes, err := json.Marshal(value)
+	assert.Nil(t, err)
+	assert.Equal(t, `["1","ut-line"]`, string(bytes))
+
+	value.Metadata = map[string]string{"k": "v"}
+	bytes, err = json.Marshal(value)
+	assert.Nil(t, err)
+	assert.Equal(t, `["1","ut-line",{"k":"v"}]`, string(bytes))
+}
+
+func TestLokiFieldString(t *testing.T) {
+	assert.Equal(t, "ut", lokiFieldString(zap.String("k", "ut")))
+	assert.Equal(t, "1", lokiFieldString(zap.Int("k", 1)))
+	assert.Equal(t, "true", lokiFieldString(zap.Bool("k", true)))
+	assert.Equal(t, `{"a":"b"}`, lokiFieldString(zap.Any("k", map[string]string{"a": "b"})))
+}
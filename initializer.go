@@ -7,14 +7,17 @@
 package rklogger
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/natefinch/lumberjack.v2"
 	"gopkg.in/yaml.v3"
 	"io/ioutil"
+	"log"
 	"os"
 	"path"
 	"reflect"
@@ -176,8 +179,21 @@ func NewZapStdoutConfig() *zap.Config {
 
 // NewZapLoggerWithBytes inits zap logger with byte array from content of config file
 // lumberjack.Logger could be empty, if not provided,
-// then, we will use default write sync
+// then, we will use default write sync.
+// LokiSyncer is attached and bootstrapped if loki section provided, refer LokiConfig
+// Rotation of each output path could be overridden in outputs section, refer OutputConfig
 func NewZapLoggerWithBytes(raw []byte, fileType FileType, opts ...zap.Option) (*zap.Logger, *zap.Config, error) {
+	logger, config, err := NewLoggerWithBytes(raw, fileType, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return logger.Logger, config, nil
+}
+
+// NewLoggerWithBytes inits Logger with byte array from content of config file, same as NewZapLoggerWithBytes
+// Close of Logger flushes LokiSyncer attached with loki section and closes every output
+func NewLoggerWithBytes(raw []byte, fileType FileType, opts ...zap.Option) (*Logger, *zap.Config, error) {
 	if raw == nil {
 		return nil, nil, errors.New("input byte array is nil")
 	}
@@ -187,10 +203,10 @@ func NewZapLoggerWithBytes(raw []byte, fileType FileType, opts ...zap.Option) (*
 	}
 
 	// Initialize zap logger from config file
-	var logger *zap.Logger
-	var err error
 	zapConfig := &zap.Config{}
 	lumberConfig := &lumberjack.Logger{}
+	lokiSection := &lokiConfigSection{}
+	outputsSection := &outputsConfigSection{}
 
 	if fileType == JSON {
 		// parse zap json file
@@ -203,7 +219,15 @@ func NewZapLoggerWithBytes(raw []byte, fileType FileType, opts ...zap.Option) (*
 			return nil, nil, err
 		}
 
-		logger, err = NewZapLoggerWithConf(zapConfig, lumberConfig, opts...)
+		// parse loki section
+		if err := json.Unmarshal(raw, lokiSection); err != nil {
+			return nil, nil, err
+		}
+
+		// parse outputs section
+		if err := json.Unmarshal(raw, outputsSection); err != nil {
+			return nil, nil, err
+		}
 	} else if fileType == YAML {
 		// parse zap yaml file
 		if err := yaml.Unmarshal(raw, zapConfig); err != nil {
@@ -215,30 +239,74 @@ func NewZapLoggerWithBytes(raw []byte, fileType FileType, opts ...zap.Option) (*
 			return nil, nil, err
 		}
 
-		logger, err = NewZapLoggerWithConf(zapConfig, lumberConfig, opts...)
+		// parse loki section
+		if err := yaml.Unmarshal(raw, lokiSection); err != nil {
+			return nil, nil, err
+		}
+
+		// parse outputs section
+		if err := yaml.Unmarshal(raw, outputsSection); err != nil {
+			return nil, nil, err
+		}
 	} else {
-		logger, err = nil, errors.New("invalid config file")
+		return nil, nil, errors.New("invalid config file")
+	}
+
+	extraSyncers := make([]zapcore.WriteSyncer, 0)
+	if lokiSection.Loki != nil {
+		// parse timestamp of entry from encoded line
+		syncer, err := NewLokiSyncerWithConfig(lokiSection.Loki, WithLokiTimeKey(zapConfig.EncoderConfig.TimeKey))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		syncer.Bootstrap(context.Background())
+		extraSyncers = append(extraSyncers, syncer)
 	}
 
+	// returned config lists every output path
+	appendOutputPaths(zapConfig, outputsSection.Outputs)
+
+	logger, err := newLogger(zapConfig, lumberConfig, outputsSection.Outputs, extraSyncers, outputsSection.LenientOutputs, opts...)
+
 	// make sure we return nil for logger and logger config
 	if err != nil {
+		// stop LokiSyncer bootstrapped above
+		for i := range extraSyncers {
+			newExtraSink(extraSyncers[i]).close(context.Background())
+		}
 		return nil, nil, err
 	}
 
 	return logger, zapConfig, err
 }
 
+// Loki section of config file
+type lokiConfigSection struct {
+	Loki *LokiConfig `yaml:"loki" json:"loki"`
+}
+
 // NewZapLoggerWithConfPath init zap logger with config file path
 // File path needs to be absolute path
 // lumberjack.Logger could be empty, if not provided,
 // then, we will use default write sync
 func NewZapLoggerWithConfPath(filePath string, fileType FileType, opts ...zap.Option) (*zap.Logger, *zap.Config, error) {
+	logger, config, err := NewLoggerWithConfPath(filePath, fileType, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return logger.Logger, config, nil
+}
+
+// NewLoggerWithConfPath inits Logger with config file path, same as NewZapLoggerWithConfPath
+func NewLoggerWithConfPath(filePath string, fileType FileType, opts ...zap.Option) (*Logger, *zap.Config, error) {
 	if len(filePath) == 0 {
 		return nil, nil, errors.New("file path is empty")
 	}
 
 	// Initialize zap logger from config file
-	var logger *zap.Logger
+	var logger *Logger
 	var err error
 	var config *zap.Config
 
@@ -250,7 +318,7 @@ func NewZapLoggerWithConfPath(filePath string, fileType FileType, opts ...zap.Op
 			return logger, config, readErr
 		}
 
-		logger, config, err = NewZapLoggerWithBytes(bytes, fileType, opts...)
+		logger, config, err = NewLoggerWithBytes(bytes, fileType, opts...)
 	}
 
 	return logger, config, err
@@ -259,49 +327,99 @@ func NewZapLoggerWithConfPath(filePath string, fileType FileType, opts ...zap.Op
 // NewZapLoggerWithConfAndSyncer
 // For backward compatibility with NewZapLoggerWithConf
 func NewZapLoggerWithConfAndSyncer(config *zap.Config, lumber *lumberjack.Logger, extraSyncers []zapcore.WriteSyncer, opts ...zap.Option) (*zap.Logger, error) {
+	return NewZapLoggerWithOutputs(config, lumber, nil, extraSyncers, opts...)
+}
+
+// NewZapLoggerWithOutputs inits zap logger with rotation config of each output path,
+// lumber is used as default of outputs and paths which are not in outputs.
+// Files are shared with other loggers and kept open till process exits since zap.Logger could not be closed.
+func NewZapLoggerWithOutputs(config *zap.Config, lumber *lumberjack.Logger, outputs []*OutputConfig, extraSyncers []zapcore.WriteSyncer, opts ...zap.Option) (*zap.Logger, error) {
+	logger, err := NewLoggerWithOutputs(config, lumber, outputs, extraSyncers, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return logger.Logger, nil
+}
+
+// NewLoggerWithOutputs inits Logger with rotation config of each output path, same as NewZapLoggerWithOutputs
+// Close of Logger syncs and closes every output, error output and extra syncer.
+// Every output and error output path is opened at once, error names each of sinks failed to open.
+func NewLoggerWithOutputs(config *zap.Config, lumber *lumberjack.Logger, outputs []*OutputConfig, extraSyncers []zapcore.WriteSyncer, opts ...zap.Option) (*Logger, error) {
+	return newLogger(config, lumber, outputs, extraSyncers, false, opts...)
+}
+
+// NewLenientLoggerWithOutputs inits Logger same as NewLoggerWithOutputs, except that sinks failed to open
+// are skipped with a warning and stderr is used instead
+func NewLenientLoggerWithOutputs(config *zap.Config, lumber *lumberjack.Logger, outputs []*OutputConfig, extraSyncers []zapcore.WriteSyncer, opts ...zap.Option) (*Logger, error) {
+	return newLogger(config, lumber, outputs, extraSyncers, true, opts...)
+}
+
+// Init Logger, sinks failed to open fall back to stderr if lenient
+func newLogger(config *zap.Config, lumber *lumberjack.Logger, outputs []*OutputConfig, extraSyncers []zapcore.WriteSyncer, lenient bool, opts ...zap.Option) (*Logger, error) {
 	// Validate parameters
 	if config == nil {
 		return nil, errors.New("zap config is nil")
 	}
 
-	if lumber == nil {
-		return config.Build(opts...)
+	// files are opened by zap without rotation, logger is built by zap.Config.Build
+	plain := lumber == nil && len(outputs) < 1
+
+	if lumber == nil && !plain {
+		lumber = &lumberjack.Logger{}
+	}
+
+	// do not modify paths of caller
+	if len(outputs) > 0 {
+		clone := *config
+		clone.OutputPaths = append([]string{}, config.OutputPaths...)
+		appendOutputPaths(&clone, outputs)
+		config = &clone
 	}
 
-	sync := make([]zapcore.WriteSyncer, 0, 0)
+	// Iterate output path and attach to lumberjack or RotatingSyncer
+	outputSinks, outputErr := newOutputSinks("output", config.OutputPaths, lumber, outputs)
+	errSinks, errOutputErr := newOutputSinks("error output", config.ErrorOutputPaths, lumber, outputs)
 
-	if extraSyncers != nil {
-		sync = append(sync, extraSyncers...)
+	if err := multierr.Append(outputErr, errOutputErr); err != nil {
+		if !lenient {
+			closeLoggerSinks(context.Background(), append(outputSinks, errSinks...))
+			return nil, err
+		}
+
+		log.Printf("Failed to open logger sinks, fall back to stderr: %s\n", err)
+		if outputErr != nil {
+			outputSinks = appendStderrSink(outputSinks)
+		}
+		if errOutputErr != nil {
+			errSinks = appendStderrSink(errSinks)
+		}
 	}
 
-	// Iterate output path and attach to lumberjack
-	// Remember, each logger will use same lumberjack logger configuration
-	for i := range config.OutputPaths {
-		if config.OutputPaths[i] != "stdout" && config.OutputPaths[i] != "stderr" {
-			lumberNew := &lumberjack.Logger{
-				Filename:   config.OutputPaths[i],
-				MaxAge:     lumber.MaxAge,
-				MaxBackups: lumber.MaxBackups,
-				MaxSize:    lumber.MaxSize,
-				Compress:   lumber.Compress,
-				LocalTime:  lumber.LocalTime,
-			}
+	sinks := make([]*loggerSink, 0, len(extraSyncers)+len(outputSinks))
+	for i := range extraSyncers {
+		sinks = append(sinks, newExtraSink(extraSyncers[i]))
+	}
+	sinks = append(sinks, outputSinks...)
 
-			sync = append(sync, zapcore.AddSync(lumberNew))
-		} else {
-			stdout, close, err := zap.Open(config.OutputPaths[i])
-			// just close the syncer if err occurs
-			if err != nil {
-				close()
-			} else {
-				sync = append(sync, stdout)
-			}
+	logger := &Logger{
+		sinks: append(sinks, errSinks...),
+	}
+
+	if plain {
+		zapLogger, err := buildZapLogger(config, combineLoggerSinks(sinks), combineLoggerSinks(errSinks), opts...)
+		if err != nil {
+			closeLoggerSinks(context.Background(), append(outputSinks, errSinks...))
+			return nil, err
 		}
+
+		logger.Logger = zapLogger
+		return logger, nil
 	}
 
 	core := zapcore.NewCore(
 		generateEncoder(config),
-		zap.CombineWriteSyncers(sync...),
+		combineLoggerSinks(sinks),
 		config.Level)
 
 	// add initial fields
@@ -311,35 +429,12 @@ func NewZapLoggerWithConfAndSyncer(config *zap.Config, lumber *lumberjack.Logger
 	}
 
 	// add error output sync
-	errSink := make([]zapcore.WriteSyncer, 0, 0)
-	if len(config.ErrorOutputPaths) > 0 {
-		for i := range config.ErrorOutputPaths {
-			if config.ErrorOutputPaths[i] != "stdout" && config.ErrorOutputPaths[i] != "stderr" {
-				lumberNew := &lumberjack.Logger{
-					Filename:   config.ErrorOutputPaths[i],
-					MaxAge:     lumber.MaxAge,
-					MaxBackups: lumber.MaxBackups,
-					MaxSize:    lumber.MaxSize,
-					Compress:   lumber.Compress,
-					LocalTime:  lumber.LocalTime,
-				}
-
-				errSink = append(errSink, zapcore.AddSync(lumberNew))
-			} else {
-				stdout, close, err := zap.Open(config.ErrorOutputPaths[i])
-				// just close the syncer if err occurs
-				if err != nil {
-					close()
-				} else {
-					errSink = append(errSink, stdout)
-				}
-			}
-		}
-
-		opts = append(opts, zap.ErrorOutput(zap.CombineWriteSyncers(errSink...)))
+	if len(errSinks) > 0 {
+		opts = append(opts, zap.ErrorOutput(combineLoggerSinks(errSinks)))
 	}
 
-	return zap.New(core, opts...).With(initialFields...), nil
+	logger.Logger = zap.New(core, opts...).With(initialFields...)
+	return logger, nil
 }
 
 // NewZapLoggerWithConf inits zap logger with config
@@ -349,6 +444,11 @@ func NewZapLoggerWithConf(config *zap.Config, lumber *lumberjack.Logger, opts ..
 	return NewZapLoggerWithConfAndSyncer(config, lumber, nil, opts...)
 }
 
+// NewLoggerWithConf inits Logger with config, same as NewZapLoggerWithConf
+func NewLoggerWithConf(config *zap.Config, lumber *lumberjack.Logger, opts ...zap.Option) (*Logger, error) {
+	return NewLoggerWithOutputs(config, lumber, nil, nil, opts...)
+}
+
 // NewLumberjackLoggerWithBytes inits lumberjack logger as write sync with raw byte array of config file
 func NewLumberjackLoggerWithBytes(raw []byte, fileType FileType) (*lumberjack.Logger, error) {
 	if raw == nil {
@@ -8,9 +8,13 @@ import (
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"testing"
+	"time"
 )
 
 func TestNewZapLoggerWithOverride(t *testing.T) {
@@ -155,6 +159,129 @@ func TestNewZapLoggerWithBytes_HappyCase(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+// With loki section
+func TestNewZapLoggerWithBytes_WithLoki(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	body := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bytes, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		body <- string(bytes)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	bytes := []byte(`
+level: info
+encoding: json
+outputPaths: []
+encoderConfig:
+  messageKey: msg
+  timeKey: ts
+  timeEncoder: rfc3339nano
+loki:
+  addr: ` + server.URL + `
+  labels:
+    app: ut
+  maxBatchWaitMs: 60000
+  tenant: ut-tenant
+  auth:
+    bearerToken: ut-token
+`)
+	logger, config, err := NewZapLoggerWithBytes(bytes, YAML)
+	assert.Nil(t, err)
+	assert.NotNil(t, config)
+
+	logger.Info("ut-msg")
+	assert.Nil(t, logger.Sync())
+
+	req := <-received
+	assert.Equal(t, "ut-tenant", req.Header.Get(LokiTenantHeader))
+	assert.Equal(t, "Bearer ut-token", req.Header.Get("Authorization"))
+	content := <-body
+	assert.Contains(t, content, `"app":"ut"`)
+	assert.Contains(t, content, "ut-msg")
+}
+
+// With invalid loki section
+func TestNewZapLoggerWithBytes_WithInvalidLoki(t *testing.T) {
+	logger, config, err := NewZapLoggerWithBytes([]byte(`{"loki": {"encoding": "invalid"}}`), JSON)
+	assert.Nil(t, logger)
+	assert.Nil(t, config)
+	assert.NotNil(t, err)
+
+	logger, config, err = NewZapLoggerWithBytes([]byte(`{"loki": "invalid"}`), JSON)
+	assert.Nil(t, logger)
+	assert.Nil(t, config)
+	assert.NotNil(t, err)
+}
+
+// With outputs section
+func TestNewZapLoggerWithBytes_WithOutputs(t *testing.T) {
+	dir := t.TempDir()
+	raw := []byte(`
+level: info
+encoding: json
+encoderConfig:
+  messageKey: msg
+outputPaths:
+  - ` + path.Join(dir, "debug.log") + `
+errorOutputPaths:
+  - stderr
+maxsize: 1
+maxage: 7
+outputs:
+  - path: ` + path.Join(dir, "debug.log") + `
+    maxage: 1
+  - path: ` + path.Join(dir, "audit.log") + `
+    maxage: 90
+    compress: true
+  - path: ` + path.Join(dir, "daily.log") + `
+    rotation: daily
+    pattern: ` + path.Join(dir, "daily-%Y%m%d.log") + `
+`)
+
+	logger, config, err := NewZapLoggerWithBytes(raw, YAML)
+	assert.Nil(t, err)
+	// path only in outputs is appended
+	assert.Equal(t, []string{path.Join(dir, "debug.log"), path.Join(dir, "audit.log"), path.Join(dir, "daily.log")}, config.OutputPaths)
+
+	logger.Info("ut-msg")
+	for _, name := range []string{"debug.log", "audit.log"} {
+		content, err := ioutil.ReadFile(path.Join(dir, name))
+		assert.Nil(t, err)
+		assert.Contains(t, string(content), "ut-msg")
+	}
+
+	// file named by date
+	content, err := ioutil.ReadFile(path.Join(dir, time.Now().UTC().Format("daily-20060102.log")))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "ut-msg")
+
+	// invalid outputs section
+	for _, raw := range []string{`{"outputs": "invalid"}`, `{"outputs": [{"path": "ut.log", "rotation": "weekly"}]}`} {
+		logger, config, err = NewZapLoggerWithBytes([]byte(raw), JSON)
+		assert.Nil(t, logger)
+		assert.Nil(t, config)
+		assert.NotNil(t, err)
+	}
+}
+
+// Paths of config are not modified
+func TestNewZapLoggerWithOutputs(t *testing.T) {
+	dir := t.TempDir()
+	config := NewZapStdoutConfig()
+
+	logger, err := NewZapLoggerWithOutputs(config, nil, []*OutputConfig{{Path: path.Join(dir, "ut.log")}}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"stdout"}, config.OutputPaths)
+
+	logger.Info("ut-msg")
+	content, err := ioutil.ReadFile(path.Join(dir, "ut.log"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "ut-msg")
+}
+
 // With empty file path
 func TestNewZapLoggerWithConfPath_WithEmptyString(t *testing.T) {
 	logger, config, err := NewZapLoggerWithConfPath("", YAML)
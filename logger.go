@@ -0,0 +1,214 @@
+package rklogger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Logger is zap.Logger which owns sinks it writes to, including files, std streams and extra syncers.
+// Call Close once logger is not used anymore.
+type Logger struct {
+	*zap.Logger
+	sinks     []*loggerSink
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Close syncs and closes every sink of logger, LokiSyncer is flushed and interrupted within ctx.
+// Errors of sinks are aggregated, Close is called once and later calls return same error.
+func (logger *Logger) Close(ctx context.Context) error {
+	logger.closeOnce.Do(func() {
+		logger.closeErr = closeLoggerSinks(ctx, logger.sinks)
+	})
+
+	return logger.closeErr
+}
+
+// Sink owned by Logger
+type loggerSink struct {
+	name   string
+	syncer zapcore.WriteSyncer
+	close  func(ctx context.Context) error
+}
+
+// Syncer which could be synced within context, like LokiSyncer
+type contextSyncer interface {
+	SyncContext(ctx context.Context) error
+}
+
+// Syncer with background jobs, like LokiSyncer
+type interruptibleSyncer interface {
+	Interrupt(ctx context.Context)
+}
+
+// Open sink of path with zap, std streams are not synced since console does not support it
+func newZapSink(path string) (*loggerSink, error) {
+	syncer, closeFunc, err := zap.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &loggerSink{
+		name:   path,
+		syncer: syncer,
+		close: func(context.Context) error {
+			var err error
+			if path != "stdout" && path != "stderr" {
+				err = syncer.Sync()
+			}
+
+			closeFunc()
+			return err
+		},
+	}, nil
+}
+
+// Open sink of output with shared writer from registry
+func newOutputWriterSink(output *OutputConfig, lumber *lumberjack.Logger) (*loggerSink, error) {
+	writer, err := OpenOutputWriter(output, lumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return &loggerSink{
+		name:   output.Path,
+		syncer: writer,
+		close: func(context.Context) error {
+			return multierr.Append(writer.Sync(), writer.Close())
+		},
+	}, nil
+}
+
+// Wrap extra syncer, it is interrupted if it runs background jobs or closed if it is io.Closer
+func newExtraSink(syncer zapcore.WriteSyncer) *loggerSink {
+	return &loggerSink{
+		name:   fmt.Sprintf("%T", syncer),
+		syncer: syncer,
+		close: func(ctx context.Context) error {
+			// std streams are neither synced nor closed
+			if syncer == os.Stdout || syncer == os.Stderr {
+				return nil
+			}
+
+			var err error
+			if s, ok := syncer.(contextSyncer); ok {
+				err = s.SyncContext(ctx)
+			} else {
+				err = syncer.Sync()
+			}
+
+			if s, ok := syncer.(interruptibleSyncer); ok {
+				s.Interrupt(ctx)
+			} else if c, ok := syncer.(io.Closer); ok {
+				err = multierr.Append(err, c.Close())
+			}
+
+			return err
+		},
+	}
+}
+
+// Close sinks in order, errors are aggregated with name of sink
+func closeLoggerSinks(ctx context.Context, sinks []*loggerSink) error {
+	var errs error
+
+	for i := range sinks {
+		if err := sinks[i].close(ctx); err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("close %s: %w", sinks[i].name, err))
+		}
+	}
+
+	return errs
+}
+
+// Combine syncers of sinks
+func combineLoggerSinks(sinks []*loggerSink) zapcore.WriteSyncer {
+	syncers := make([]zapcore.WriteSyncer, 0, len(sinks))
+	for i := range sinks {
+		syncers = append(syncers, sinks[i].syncer)
+	}
+
+	return zap.CombineWriteSyncers(syncers...)
+}
+
+// Scheme of sinks handed over to zap.Config.Build, so that zap builds logger writing into sinks owned by Logger
+const loggerSinkScheme = "rklogger"
+
+var (
+	loggerSinkOnce    sync.Once
+	loggerSinkErr     error
+	loggerSinkID      uint64
+	loggerSinkPending = map[string]zapcore.WriteSyncer{}
+	loggerSinkMutex   sync.Mutex
+)
+
+// Sink of zap which is closed by Logger instead of zap
+type zapOwnedSink struct {
+	zapcore.WriteSyncer
+}
+
+// Close is noop
+func (sink *zapOwnedSink) Close() error {
+	return nil
+}
+
+// Build logger with zap.Config.Build, so that encoder and options are same as zap,
+// outputs and error outputs of config are replaced with sinks
+func buildZapLogger(config *zap.Config, sink, errSink zapcore.WriteSyncer, opts ...zap.Option) (*zap.Logger, error) {
+	loggerSinkOnce.Do(func() {
+		loggerSinkErr = zap.RegisterSink(loggerSinkScheme, func(u *url.URL) (zap.Sink, error) {
+			loggerSinkMutex.Lock()
+			defer loggerSinkMutex.Unlock()
+
+			syncer, ok := loggerSinkPending[u.Opaque]
+			if !ok {
+				return nil, fmt.Errorf("logger sink %s not found", u)
+			}
+			delete(loggerSinkPending, u.Opaque)
+
+			return &zapOwnedSink{WriteSyncer: syncer}, nil
+		})
+	})
+	if loggerSinkErr != nil {
+		return nil, loggerSinkErr
+	}
+
+	clone := *config
+	clone.OutputPaths = []string{pendingZapSink(sink)}
+	clone.ErrorOutputPaths = []string{pendingZapSink(errSink)}
+
+	// sinks are not taken by zap if config is invalid
+	defer func() {
+		loggerSinkMutex.Lock()
+		defer loggerSinkMutex.Unlock()
+
+		for _, path := range append(clone.OutputPaths, clone.ErrorOutputPaths...) {
+			delete(loggerSinkPending, strings.TrimPrefix(path, loggerSinkScheme+":"))
+		}
+	}()
+
+	return clone.Build(opts...)
+}
+
+// Add sink waiting to be taken by zap, returns path of it
+func pendingZapSink(sink zapcore.WriteSyncer) string {
+	id := strconv.FormatUint(atomic.AddUint64(&loggerSinkID, 1), 10)
+
+	loggerSinkMutex.Lock()
+	defer loggerSinkMutex.Unlock()
+
+	loggerSinkPending[id] = sink
+	return loggerSinkScheme + ":" + id
+}
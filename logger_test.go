@@ -0,0 +1,234 @@
+package rklogger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rookie-ninja/rk-logger/lokitest"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Extra syncer which fails on Sync and Close
+type failingSyncer struct {
+	closed int
+}
+
+func (syncer *failingSyncer) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (syncer *failingSyncer) Sync() error {
+	return errors.New("ut-sync-error")
+}
+
+func (syncer *failingSyncer) Close() error {
+	syncer.closed++
+	return errors.New("ut-close-error")
+}
+
+func TestNewLoggerWithOutputs_Close(t *testing.T) {
+	server := lokitest.NewServer()
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "ut.log")
+	config := &zap.Config{
+		Level:            zap.NewAtomicLevelAt(zap.InfoLevel),
+		Encoding:         "console",
+		EncoderConfig:    zap.NewProductionEncoderConfig(),
+		OutputPaths:      []string{"stdout", path},
+		ErrorOutputPaths: []string{"stderr", path},
+	}
+
+	syncer := NewLokiSyncer(WithLokiAddr(server.Addr()), WithLokiMaxBatchWaitMs(time.Hour))
+	syncer.Bootstrap(context.Background())
+
+	logger, err := NewLoggerWithOutputs(config, &lumberjack.Logger{}, nil, []zapcore.WriteSyncer{syncer})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, outputRegistry.writers[path].refs)
+
+	logger.Info("ut-msg")
+
+	// flushed and released
+	assert.Nil(t, logger.Close(context.Background()))
+	assert.Len(t, server.Lines(), 1)
+	assert.Contains(t, server.Lines()[0], "ut-msg")
+	assert.NotContains(t, outputRegistry.writers, path)
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Contains(t, string(content), "ut-msg")
+
+	// closed once
+	assert.Nil(t, logger.Close(context.Background()))
+}
+
+func TestLogger_Close_WithError(t *testing.T) {
+	syncer := &failingSyncer{}
+
+	logger, err := NewLoggerWithOutputs(&zap.Config{
+		Level:         zap.NewAtomicLevelAt(zap.InfoLevel),
+		EncoderConfig: zap.NewProductionEncoderConfig(),
+	}, &lumberjack.Logger{}, nil, []zapcore.WriteSyncer{syncer})
+	assert.Nil(t, err)
+
+	err = logger.Close(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("close %T: ut-sync-error", syncer))
+	assert.Contains(t, err.Error(), "ut-close-error")
+
+	// same error is returned without closing again
+	assert.Equal(t, err, logger.Close(context.Background()))
+	assert.Equal(t, 1, syncer.closed)
+}
+
+func TestNewLoggerWithConf_WithoutLumberjack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ut.log")
+	config := &zap.Config{
+		Level:         zap.NewAtomicLevelAt(zap.InfoLevel),
+		Encoding:      "json",
+		EncoderConfig: zap.NewProductionEncoderConfig(),
+		OutputPaths:   []string{path},
+		InitialFields: map[string]interface{}{"app": "ut"},
+	}
+
+	logger, err := NewLoggerWithConf(config, nil)
+	assert.Nil(t, err)
+	assert.NotContains(t, outputRegistry.writers, path)
+
+	// options of zap.Config.Build are applied
+	logger.Error("ut-msg")
+	assert.Nil(t, logger.Close(context.Background()))
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Contains(t, string(content), `"app":"ut"`)
+	assert.Contains(t, string(content), "logger_test.go")
+	assert.Contains(t, string(content), `"stacktrace"`)
+
+	// without level
+	logger, err = NewLoggerWithConf(&zap.Config{}, nil)
+	assert.Nil(t, logger)
+	assert.NotNil(t, err)
+
+	// encoding is validated by zap
+	config.Encoding = "bogus"
+	logger, err = NewLoggerWithConf(config, nil)
+	assert.Nil(t, logger)
+	assert.EqualError(t, err, `no encoder registered for name "bogus"`)
+	assert.Empty(t, loggerSinkPending)
+
+	// encoder registered to zap, registration fails if test runs again in same process
+	zap.RegisterEncoder("ut-encoder", func(zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "ut-key"}), nil
+	})
+	config.Encoding = "ut-encoder"
+	logger, err = NewLoggerWithConf(config, nil)
+	assert.Nil(t, err)
+	logger.Info("ut-registered")
+	assert.Nil(t, logger.Close(context.Background()))
+
+	content, _ = ioutil.ReadFile(path)
+	assert.Contains(t, string(content), `{"ut-key":"ut-registered","app":"ut"}`)
+}
+
+func TestNewLoggerWithBytes_Close(t *testing.T) {
+	server := lokitest.NewServer()
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "ut.log")
+	raw := strings.Join([]string{
+		`level: info`,
+		`encoding: json`,
+		`encoderConfig:`,
+		`  messageKey: msg`,
+		`outputPaths: ["` + path + `"]`,
+		`loki:`,
+		`  addr: ` + server.Addr(),
+		`  maxBatchWaitMs: 3600000`,
+	}, "\n")
+
+	logger, config, err := NewLoggerWithBytes([]byte(raw), YAML)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{path}, config.OutputPaths)
+
+	logger.Info("ut-msg")
+	assert.Nil(t, logger.Close(context.Background()))
+
+	assert.Equal(t, []string{"{\"msg\":\"ut-msg\"}\n"}, server.Lines())
+	assert.NotContains(t, outputRegistry.writers, path)
+
+	// with invalid output
+	raw += "\noutputs:\n  - path: " + path + "\n    rotation: weekly"
+	logger, config, err = NewLoggerWithBytes([]byte(raw), YAML)
+	assert.Nil(t, logger)
+	assert.Nil(t, config)
+	assert.NotNil(t, err)
+}
+
+func TestNewLoggerWithOutputs_WithInvalidPaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ut.log")
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte{}, 0644))
+
+	config := &zap.Config{
+		Level:            zap.NewAtomicLevelAt(zap.InfoLevel),
+		Encoding:         "json",
+		EncoderConfig:    zap.NewProductionEncoderConfig(),
+		OutputPaths:      []string{path, filepath.Join(dir, "file", "ut.log")},
+		ErrorOutputPaths: []string{filepath.Join(dir, "file", "error.log")},
+	}
+
+	// every failed sink is named
+	logger, err := NewLoggerWithOutputs(config, &lumberjack.Logger{}, nil, nil)
+	assert.Nil(t, logger)
+	assert.Len(t, multierr.Errors(err), 2)
+	assert.Contains(t, err.Error(), "open output "+filepath.Join(dir, "file", "ut.log"))
+	assert.Contains(t, err.Error(), "open error output "+filepath.Join(dir, "file", "error.log"))
+	// opened sinks are released
+	assert.NotContains(t, outputRegistry.writers, path)
+
+	// same without lumberjack
+	logger, err = NewLoggerWithConf(config, nil)
+	assert.Nil(t, logger)
+	assert.Len(t, multierr.Errors(err), 2)
+
+	// fall back to stderr
+	logger, err = NewLenientLoggerWithOutputs(config, &lumberjack.Logger{}, nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, logger.sinks, 3)
+	assert.Equal(t, "stderr", logger.sinks[1].name)
+	assert.Equal(t, "stderr", logger.sinks[2].name)
+
+	logger.Info("ut-msg")
+	assert.Nil(t, logger.Close(context.Background()))
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Contains(t, string(content), "ut-msg")
+}
+
+func TestNewLoggerWithBytes_WithLenientOutputs(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte{}, 0644))
+
+	raw := strings.Join([]string{
+		`level: info`,
+		`outputPaths: ["` + filepath.Join(dir, "file", "ut.log") + `"]`,
+	}, "\n")
+
+	logger, _, err := NewLoggerWithBytes([]byte(raw), YAML)
+	assert.Nil(t, logger)
+	assert.NotNil(t, err)
+
+	logger, _, err = NewLoggerWithBytes([]byte(raw+"\nlenientOutputs: true"), YAML)
+	assert.Nil(t, err)
+	assert.Len(t, logger.sinks, 1)
+	assert.Equal(t, "stderr", logger.sinks[0].name)
+	assert.Nil(t, logger.Close(context.Background()))
+}
@@ -0,0 +1,103 @@
+// Package lokiprom exposes Stats of rklogger.LokiSyncer as prometheus metrics.
+package lokiprom
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	rklogger "github.com/rookie-ninja/rk-logger"
+)
+
+// StatsSource provides snapshot of LokiStats, which is implemented by rklogger.LokiSyncer
+type StatsSource interface {
+	Stats() rklogger.LokiStats
+}
+
+// NewCollector create prometheus.Collector which exposes Stats of LokiSyncer,
+// metrics are named as <namespace>_loki_syncer_<name>, syncer label distinguishes multiple syncers in one registry
+func NewCollector(syncer StatsSource, namespace, syncerName string) *Collector {
+	labels := prometheus.Labels{"syncer": syncerName}
+	newDesc := func(name, help string, variableLabels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "loki_syncer", name), help, variableLabels, labels)
+	}
+
+	return &Collector{
+		syncer:           syncer,
+		entriesBuffered:  newDesc("entries_buffered_total", "Number of entries accepted into buffer."),
+		entriesSent:      newDesc("entries_sent_total", "Number of entries accepted by loki."),
+		entriesDropped:   newDesc("entries_dropped_total", "Number of entries dropped."),
+		entriesAbandoned: newDesc("entries_abandoned_total", "Number of entries not sent before shutdown deadline."),
+		linesTruncated:   newDesc("lines_truncated_total", "Number of lines truncated to max line bytes."),
+		linesDropped:     newDesc("lines_dropped_total", "Number of entries dropped since line exceeds max line bytes."),
+		labelsRejected:   newDesc("labels_rejected_total", "Number of labels rejected since value is empty or too long."),
+		streamsLimited:   newDesc("streams_limited_total", "Number of entries sent with static labels only since max streams reached."),
+		batchesFailed:    newDesc("batches_failed_total", "Number of failed batches by HTTP status code, 0 stands for network errors.", "code"),
+		requestLatency:   newDesc("request_duration_seconds", "Latency of push requests."),
+		bufferDepth:      newDesc("buffer_depth", "Number of entries currently buffered."),
+		endpointHealthy:  newDesc("endpoint_healthy", "Whether loki endpoint is healthy.", "endpoint"),
+		endpointFailures: newDesc("endpoint_failures_total", "Number of failed requests to loki endpoint.", "endpoint"),
+	}
+}
+
+// Collector is prometheus.Collector of LokiSyncer Stats
+type Collector struct {
+	syncer           StatsSource
+	entriesBuffered  *prometheus.Desc
+	entriesSent      *prometheus.Desc
+	entriesDropped   *prometheus.Desc
+	entriesAbandoned *prometheus.Desc
+	linesTruncated   *prometheus.Desc
+	linesDropped     *prometheus.Desc
+	labelsRejected   *prometheus.Desc
+	streamsLimited   *prometheus.Desc
+	batchesFailed    *prometheus.Desc
+	requestLatency   *prometheus.Desc
+	bufferDepth      *prometheus.Desc
+	endpointHealthy  *prometheus.Desc
+	endpointFailures *prometheus.Desc
+}
+
+// Describe sends descriptors of metrics
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.entriesBuffered
+	ch <- c.entriesSent
+	ch <- c.entriesDropped
+	ch <- c.entriesAbandoned
+	ch <- c.linesTruncated
+	ch <- c.linesDropped
+	ch <- c.labelsRejected
+	ch <- c.streamsLimited
+	ch <- c.batchesFailed
+	ch <- c.requestLatency
+	ch <- c.bufferDepth
+	ch <- c.endpointHealthy
+	ch <- c.endpointFailures
+}
+
+// Collect sends metrics from snapshot of Stats
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.syncer.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.entriesBuffered, prometheus.CounterValue, float64(stats.EntriesBuffered))
+	ch <- prometheus.MustNewConstMetric(c.entriesSent, prometheus.CounterValue, float64(stats.EntriesSent))
+	ch <- prometheus.MustNewConstMetric(c.entriesDropped, prometheus.CounterValue, float64(stats.EntriesDropped))
+	ch <- prometheus.MustNewConstMetric(c.entriesAbandoned, prometheus.CounterValue, float64(stats.EntriesAbandoned))
+	ch <- prometheus.MustNewConstMetric(c.linesTruncated, prometheus.CounterValue, float64(stats.LinesTruncated))
+	ch <- prometheus.MustNewConstMetric(c.linesDropped, prometheus.CounterValue, float64(stats.LinesDropped))
+	ch <- prometheus.MustNewConstMetric(c.labelsRejected, prometheus.CounterValue, float64(stats.LabelsRejected))
+	ch <- prometheus.MustNewConstMetric(c.streamsLimited, prometheus.CounterValue, float64(stats.StreamsLimited))
+	for code, count := range stats.BatchesFailed {
+		ch <- prometheus.MustNewConstMetric(c.batchesFailed, prometheus.CounterValue, float64(count), strconv.Itoa(code))
+	}
+	ch <- prometheus.MustNewConstHistogram(c.requestLatency,
+		stats.RequestLatency.Count, stats.RequestLatency.Sum, stats.RequestLatency.Buckets)
+	ch <- prometheus.MustNewConstMetric(c.bufferDepth, prometheus.GaugeValue, float64(stats.BufferDepth))
+	for _, ep := range stats.Endpoints {
+		healthy := 0.0
+		if ep.Healthy {
+			healthy = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.endpointHealthy, prometheus.GaugeValue, healthy, ep.Url)
+		ch <- prometheus.MustNewConstMetric(c.endpointFailures, prometheus.CounterValue, float64(ep.Failures), ep.Url)
+	}
+}
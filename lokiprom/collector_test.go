@@ -0,0 +1,62 @@
+package lokiprom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	rklogger "github.com/rookie-ninja/rk-logger"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+// StatsSource with fixed stats
+type fakeStatsSource rklogger.LokiStats
+
+func (source fakeStatsSource) Stats() rklogger.LokiStats {
+	return rklogger.LokiStats(source)
+}
+
+func TestCollector(t *testing.T) {
+	source := fakeStatsSource{
+		EntriesBuffered: 1,
+		BatchesFailed:   map[int]uint64{http.StatusTooManyRequests: 1},
+		RequestLatency:  rklogger.LokiLatencyHistogram{Buckets: map[float64]uint64{}},
+		BufferDepth:     1,
+		Endpoints:       []rklogger.LokiEndpointStats{{Url: "http://localhost:3100", Healthy: true}},
+	}
+
+	registry := prometheus.NewRegistry()
+	assert.Nil(t, registry.Register(NewCollector(source, "ut", "default")))
+
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+
+	metrics := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch {
+			case metric.GetCounter() != nil:
+				metrics[family.GetName()] = metric.GetCounter().GetValue()
+			case metric.GetGauge() != nil:
+				metrics[family.GetName()] = metric.GetGauge().GetValue()
+			case metric.GetHistogram() != nil:
+				metrics[family.GetName()] = float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+
+	assert.Equal(t, map[string]float64{
+		"ut_loki_syncer_entries_buffered_total":   1,
+		"ut_loki_syncer_entries_sent_total":       0,
+		"ut_loki_syncer_entries_dropped_total":    0,
+		"ut_loki_syncer_entries_abandoned_total":  0,
+		"ut_loki_syncer_lines_truncated_total":    0,
+		"ut_loki_syncer_lines_dropped_total":      0,
+		"ut_loki_syncer_labels_rejected_total":    0,
+		"ut_loki_syncer_streams_limited_total":    0,
+		"ut_loki_syncer_batches_failed_total":     1,
+		"ut_loki_syncer_request_duration_seconds": 0,
+		"ut_loki_syncer_buffer_depth":             1,
+		"ut_loki_syncer_endpoint_healthy":         1,
+		"ut_loki_syncer_endpoint_failures_total":  0,
+	}, metrics)
+}
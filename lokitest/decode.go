@@ -0,0 +1,292 @@
+package lokitest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of logproto.PushRequest, logproto.StreamAdapter, logproto.EntryAdapter,
+// logproto.LabelPairAdapter and google.protobuf.Timestamp
+//
+// Refer https://github.com/grafana/loki/blob/main/pkg/push/push.proto
+const (
+	protoPushRequestStreams   protowire.Number = 1
+	protoStreamLabels         protowire.Number = 1
+	protoStreamEntries        protowire.Number = 2
+	protoEntryTimestamp       protowire.Number = 1
+	protoEntryLine            protowire.Number = 2
+	protoEntryMetadata        protowire.Number = 3
+	protoLabelPairName        protowire.Number = 1
+	protoLabelPairValue       protowire.Number = 2
+	protoTimestampSeconds     protowire.Number = 1
+	protoTimestampNanoseconds protowire.Number = 2
+)
+
+// Decode push request by content type, body could be gzip compressed
+func decodePushRequest(r *http.Request) ([]*Stream, error) {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-protobuf") {
+		return decodeProto(body)
+	}
+
+	return decodeJson(body)
+}
+
+// Decode json push request, values are ["<unix epoch in nanoseconds>", "<log line>", {<structured metadata>}]
+func decodeJson(body []byte) ([]*Stream, error) {
+	req := &struct {
+		Streams []struct {
+			Stream map[string]string   `json:"stream"`
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"streams"`
+	}{}
+
+	if err := json.Unmarshal(body, req); err != nil {
+		return nil, err
+	}
+
+	res := make([]*Stream, 0, len(req.Streams))
+	for _, stream := range req.Streams {
+		decoded := &Stream{
+			Labels:  stream.Stream,
+			Entries: make([]Entry, 0, len(stream.Values)),
+		}
+
+		for _, value := range stream.Values {
+			if len(value) < 2 || len(value) > 3 {
+				return nil, fmt.Errorf("invalid value with %d elements", len(value))
+			}
+
+			var ts, line string
+			if err := json.Unmarshal(value[0], &ts); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(value[1], &line); err != nil {
+				return nil, err
+			}
+
+			nanos, err := strconv.ParseInt(ts, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+
+			entry := Entry{
+				Timestamp: time.Unix(0, nanos),
+				Line:      line,
+			}
+			if len(value) > 2 {
+				if err := json.Unmarshal(value[2], &entry.Metadata); err != nil {
+					return nil, err
+				}
+			}
+
+			decoded.Entries = append(decoded.Entries, entry)
+		}
+
+		res = append(res, decoded)
+	}
+
+	return res, nil
+}
+
+// Decode snappy compressed logproto.PushRequest
+func decodeProto(body []byte) ([]*Stream, error) {
+	raw, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Stream, 0)
+	err = consumeFields(raw, func(num protowire.Number, v []byte, _ uint64) error {
+		if num != protoPushRequestStreams {
+			return nil
+		}
+
+		stream, err := decodeProtoStream(v)
+		if err != nil {
+			return err
+		}
+
+		res = append(res, stream)
+		return nil
+	})
+
+	return res, err
+}
+
+// Decode logproto.StreamAdapter
+func decodeProtoStream(b []byte) (*Stream, error) {
+	stream := &Stream{
+		Entries: make([]Entry, 0),
+	}
+
+	err := consumeFields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case protoStreamLabels:
+			labels, err := parseLabels(string(v))
+			if err != nil {
+				return err
+			}
+			stream.Labels = labels
+		case protoStreamEntries:
+			entry, err := decodeProtoEntry(v)
+			if err != nil {
+				return err
+			}
+			stream.Entries = append(stream.Entries, entry)
+		}
+
+		return nil
+	})
+
+	return stream, err
+}
+
+// Decode logproto.EntryAdapter
+func decodeProtoEntry(b []byte) (Entry, error) {
+	entry := Entry{}
+
+	err := consumeFields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case protoEntryTimestamp:
+			var sec, nsec uint64
+			err := consumeFields(v, func(num protowire.Number, _ []byte, x uint64) error {
+				switch num {
+				case protoTimestampSeconds:
+					sec = x
+				case protoTimestampNanoseconds:
+					nsec = x
+				}
+				return nil
+			})
+			entry.Timestamp = time.Unix(int64(sec), int64(nsec))
+			return err
+		case protoEntryLine:
+			entry.Line = string(v)
+		case protoEntryMetadata:
+			var name, value string
+			err := consumeFields(v, func(num protowire.Number, v []byte, _ uint64) error {
+				switch num {
+				case protoLabelPairName:
+					name = string(v)
+				case protoLabelPairValue:
+					value = string(v)
+				}
+				return nil
+			})
+			if entry.Metadata == nil {
+				entry.Metadata = map[string]string{}
+			}
+			entry.Metadata[name] = value
+			return err
+		}
+
+		return nil
+	})
+
+	return entry, err
+}
+
+// Call f with every length delimited or varint field of protobuf message
+func consumeFields(b []byte, f func(num protowire.Number, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var err error
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			err = f(num, v, 0)
+			b = b[n:]
+		case protowire.VarintType:
+			x, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			err = f(num, nil, x)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Parse labels formatted like {k1="v1", k2="v2"}
+func parseLabels(s string) (map[string]string, error) {
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("invalid labels: %s", s)
+	}
+
+	res := map[string]string{}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	for len(s) > 0 {
+		idx := strings.IndexByte(s, '=')
+		if idx < 1 {
+			return nil, fmt.Errorf("invalid label name: %s", s)
+		}
+		name := strings.TrimSpace(s[:idx])
+		s = s[idx+1:]
+
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label value of %s: %s", name, err)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, err
+		}
+		res[name] = value
+
+		s = strings.TrimSpace(s[len(quoted):])
+		if len(s) > 0 {
+			if s[0] != ',' {
+				return nil, errors.New("labels should be separated by comma")
+			}
+			s = strings.TrimSpace(s[1:])
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,92 @@
+package lokitest
+
+import (
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"testing"
+	"time"
+)
+
+func TestDecodeJson(t *testing.T) {
+	streams, err := decodeJson([]byte(testJsonBody))
+	assert.Nil(t, err)
+	assert.Len(t, streams, 2)
+	assert.Equal(t, map[string]string{"app": "ut", "level": "info"}, streams[0].Labels)
+	assert.Equal(t, "ut-line-2", streams[0].Entries[1].Line)
+	assert.Equal(t, time.Unix(2, 0), streams[0].Entries[1].Timestamp)
+
+	// invalid values
+	bodies := []string{
+		`{"streams":[{"stream":{},"values":[["1"]]}]}`,
+		`{"streams":[{"stream":{},"values":[[1,"ut"]]}]}`,
+		`{"streams":[{"stream":{},"values":[["ut","ut"]]}]}`,
+		`{"streams":[{"stream":{},"values":[["1",1]]}]}`,
+		`{"streams":[{"stream":{},"values":[["1","ut","ut"]]}]}`,
+	}
+	for i := range bodies {
+		_, err = decodeJson([]byte(bodies[i]))
+		assert.NotNil(t, err)
+	}
+}
+
+func TestDecodeProto(t *testing.T) {
+	timestamp := protowire.AppendTag(nil, protoTimestampSeconds, protowire.VarintType)
+	timestamp = protowire.AppendVarint(timestamp, 1)
+	timestamp = protowire.AppendTag(timestamp, protoTimestampNanoseconds, protowire.VarintType)
+	timestamp = protowire.AppendVarint(timestamp, 2)
+
+	metadata := protowire.AppendTag(nil, protoLabelPairName, protowire.BytesType)
+	metadata = protowire.AppendString(metadata, "trace")
+	metadata = protowire.AppendTag(metadata, protoLabelPairValue, protowire.BytesType)
+	metadata = protowire.AppendString(metadata, "ut-trace")
+
+	entry := protowire.AppendTag(nil, protoEntryTimestamp, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, timestamp)
+	entry = protowire.AppendTag(entry, protoEntryLine, protowire.BytesType)
+	entry = protowire.AppendString(entry, "ut-line")
+	entry = protowire.AppendTag(entry, protoEntryMetadata, protowire.BytesType)
+	entry = protowire.AppendBytes(entry, metadata)
+
+	stream := protowire.AppendTag(nil, protoStreamLabels, protowire.BytesType)
+	stream = protowire.AppendString(stream, `{app="ut", msg="a \"b\", c"}`)
+	stream = protowire.AppendTag(stream, protoStreamEntries, protowire.BytesType)
+	stream = protowire.AppendBytes(stream, entry)
+
+	req := protowire.AppendTag(nil, protoPushRequestStreams, protowire.BytesType)
+	req = protowire.AppendBytes(req, stream)
+
+	streams, err := decodeProto(snappy.Encode(nil, req))
+	assert.Nil(t, err)
+	assert.Len(t, streams, 1)
+	assert.Equal(t, map[string]string{"app": "ut", "msg": `a "b", c`}, streams[0].Labels)
+	assert.Len(t, streams[0].Entries, 1)
+	assert.Equal(t, time.Unix(1, 2), streams[0].Entries[0].Timestamp)
+	assert.Equal(t, "ut-line", streams[0].Entries[0].Line)
+	assert.Equal(t, "ut-trace", streams[0].Entries[0].Metadata["trace"])
+
+	// without snappy
+	_, err = decodeProto(req)
+	assert.NotNil(t, err)
+
+	// truncated message
+	_, err = decodeProto(snappy.Encode(nil, req[:len(req)-1]))
+	assert.NotNil(t, err)
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := parseLabels(`{}`)
+	assert.Nil(t, err)
+	assert.Empty(t, labels)
+
+	labels, err = parseLabels(`{a="1",b="2"}`)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, labels)
+
+	// invalid labels
+	invalid := []string{`a="1"`, `{="1"}`, `{a=1}`, `{a="1" b="2"}`}
+	for i := range invalid {
+		_, err = parseLabels(invalid[i])
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,302 @@
+// Package lokitest provides an in-process fake loki push endpoint for tests.
+package lokitest
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PushPath is path of loki push API served by Server
+	PushPath = "/loki/api/v1/push"
+	// TenantHeader is HTTP header of tenant ID
+	TenantHeader = "X-Scope-OrgID"
+)
+
+// Entry is log entry received by Server
+type Entry struct {
+	Timestamp time.Time
+	Line      string
+	Metadata  map[string]string
+}
+
+// Stream is entries with same labels and tenant received by Server
+type Stream struct {
+	Labels  map[string]string
+	Tenant  string
+	Entries []Entry
+}
+
+// Request is push request received by Server, including failed ones
+type Request struct {
+	Header     http.Header
+	StatusCode int
+}
+
+// Injected failure of push request
+type failure struct {
+	statusCode int
+	reset      bool
+}
+
+// NewServer starts fake loki server which accepts json and protobuf push requests,
+// optionally gzip compressed, and stores streams in memory. Caller should Close it.
+func NewServer() *Server {
+	server := &Server{
+		streams:  make([]*Stream, 0),
+		lines:    make([]string, 0),
+		requests: make([]Request, 0),
+		failures: make([]failure, 0),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(PushPath, server.handle)
+	server.Server = httptest.NewServer(mux)
+
+	return server
+}
+
+// Server is fake loki server backed by httptest.Server
+type Server struct {
+	*httptest.Server
+	streams  []*Stream
+	lines    []string
+	requests []Request
+	failures []failure
+	latency  time.Duration
+	mutex    sync.Mutex
+}
+
+// Addr returns host:port of server
+func (server *Server) Addr() string {
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+// Streams returns copy of streams whose labels contain every given label, all streams are returned if labels is empty
+func (server *Server) Streams(labels map[string]string) []Stream {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	res := make([]Stream, 0)
+	for _, stream := range server.streams {
+		if !matchLabels(stream.Labels, labels) {
+			continue
+		}
+
+		res = append(res, Stream{
+			Labels:  copyLabels(stream.Labels),
+			Tenant:  stream.Tenant,
+			Entries: append([]Entry{}, stream.Entries...),
+		})
+	}
+
+	return res
+}
+
+// Lines returns every line in order of receiving
+func (server *Server) Lines() []string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return append([]string{}, server.lines...)
+}
+
+// Requests returns every push request received, including failed ones
+func (server *Server) Requests() []Request {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return append([]Request{}, server.requests...)
+}
+
+// Clear removes received streams, lines and requests
+func (server *Server) Clear() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.streams = make([]*Stream, 0)
+	server.lines = make([]string, 0)
+	server.requests = make([]Request, 0)
+}
+
+// FailNext responds next n push requests with status code without storing them
+func (server *Server) FailNext(n int, statusCode int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	for i := 0; i < n; i++ {
+		server.failures = append(server.failures, failure{statusCode: statusCode})
+	}
+}
+
+// ResetNext closes connection of next n push requests without response
+func (server *Server) ResetNext(n int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	for i := 0; i < n; i++ {
+		server.failures = append(server.failures, failure{reset: true})
+	}
+}
+
+// SetLatency delays every push request, request canceled by client meanwhile is dropped
+func (server *Server) SetLatency(latency time.Duration) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.latency = latency
+}
+
+// Handle push request
+func (server *Server) handle(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	latency := server.latency
+	var injected *failure
+	if len(server.failures) > 0 {
+		injected = &server.failures[0]
+		server.failures = server.failures[1:]
+	}
+	server.mutex.Unlock()
+
+	// body is read first, so canceled request could be noticed while waiting
+	streams, err := decodePushRequest(r)
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	switch {
+	case injected != nil && injected.reset:
+		server.record(r, 0)
+		server.reset(w)
+		return
+	case injected != nil:
+		server.record(r, injected.statusCode)
+		http.Error(w, http.StatusText(injected.statusCode), injected.statusCode)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		server.record(r, http.StatusMethodNotAllowed)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		server.record(r, http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server.store(r.Header.Get(TenantHeader), streams)
+	server.record(r, http.StatusNoContent)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Record request with status code
+func (server *Server) record(r *http.Request, statusCode int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.requests = append(server.requests, Request{
+		Header:     r.Header.Clone(),
+		StatusCode: statusCode,
+	})
+}
+
+// Close connection immediately, client would see connection reset
+func (server *Server) reset(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// Merge decoded streams into streams with same labels and tenant
+func (server *Server) store(tenant string, streams []*Stream) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	for _, decoded := range streams {
+		var target *Stream
+		for _, stream := range server.streams {
+			if stream.Tenant == tenant && labelString(stream.Labels) == labelString(decoded.Labels) {
+				target = stream
+				break
+			}
+		}
+
+		if target == nil {
+			target = &Stream{
+				Labels:  decoded.Labels,
+				Tenant:  tenant,
+				Entries: make([]Entry, 0),
+			}
+			server.streams = append(server.streams, target)
+		}
+
+		for _, entry := range decoded.Entries {
+			target.Entries = append(target.Entries, entry)
+			server.lines = append(server.lines, entry.Line)
+		}
+	}
+}
+
+// Returns true if labels contain every matcher
+func matchLabels(labels, matchers map[string]string) bool {
+	for k, v := range matchers {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Copy labels
+func copyLabels(labels map[string]string) map[string]string {
+	res := make(map[string]string, len(labels))
+	for k, v := range labels {
+		res[k] = v
+	}
+
+	return res
+}
+
+// Convert labels to string with sorted keys
+func labelString(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	builder := strings.Builder{}
+	for i := range keys {
+		builder.WriteString(keys[i])
+		builder.WriteByte('=')
+		builder.WriteString(labels[keys[i]])
+		builder.WriteByte(0)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,174 @@
+package lokitest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const testJsonBody = `{"streams":[{"stream":{"app":"ut","level":"info"},"values":[["1000000000","ut-line-1"],["2000000000","ut-line-2",{"trace":"ut-trace"}]]},{"stream":{"app":"ut","level":"error"},"values":[["3000000000","ut-line-3"]]}]}`
+
+// Push body to server with headers
+func push(t *testing.T, server *Server, body []byte, header map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, server.URL+PushPath, bytes.NewReader(body))
+	assert.Nil(t, err)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+
+	return resp, err
+}
+
+func TestNewServer(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	assert.NotEmpty(t, server.Addr())
+	assert.Empty(t, server.Streams(nil))
+	assert.Empty(t, server.Lines())
+	assert.Empty(t, server.Requests())
+}
+
+func TestServer_Streams(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	resp, err := push(t, server, []byte(testJsonBody), map[string]string{
+		"Content-Type": "application/json",
+		TenantHeader:   "ut-tenant",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// all streams
+	assert.Len(t, server.Streams(nil), 2)
+	assert.Len(t, server.Streams(map[string]string{"app": "ut"}), 2)
+
+	// with matcher
+	streams := server.Streams(map[string]string{"level": "info"})
+	assert.Len(t, streams, 1)
+	assert.Equal(t, "ut-tenant", streams[0].Tenant)
+	assert.Len(t, streams[0].Entries, 2)
+	assert.Equal(t, time.Unix(1, 0), streams[0].Entries[0].Timestamp)
+	assert.Equal(t, "ut-trace", streams[0].Entries[1].Metadata["trace"])
+
+	// without match
+	assert.Empty(t, server.Streams(map[string]string{"level": "debug"}))
+
+	// same labels are merged
+	_, err = push(t, server, []byte(testJsonBody), map[string]string{TenantHeader: "ut-tenant"})
+	assert.Nil(t, err)
+	assert.Len(t, server.Streams(nil), 2)
+	assert.Len(t, server.Streams(map[string]string{"level": "info"})[0].Entries, 4)
+
+	// different tenant is different stream
+	_, err = push(t, server, []byte(testJsonBody), nil)
+	assert.Nil(t, err)
+	assert.Len(t, server.Streams(nil), 4)
+}
+
+func TestServer_Lines(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	// with gzip
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	gz.Write([]byte(testJsonBody))
+	gz.Close()
+
+	_, err := push(t, server, buf.Bytes(), map[string]string{"Content-Encoding": "gzip"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ut-line-1", "ut-line-2", "ut-line-3"}, server.Lines())
+
+	// clear
+	server.Clear()
+	assert.Empty(t, server.Lines())
+	assert.Empty(t, server.Streams(nil))
+	assert.Empty(t, server.Requests())
+}
+
+func TestServer_FailNext(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.FailNext(2, http.StatusTooManyRequests)
+
+	for i := 0; i < 2; i++ {
+		resp, err := push(t, server, []byte(testJsonBody), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	}
+	assert.Empty(t, server.Lines())
+
+	resp, err := push(t, server, []byte(testJsonBody), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Len(t, server.Lines(), 3)
+
+	requests := server.Requests()
+	assert.Len(t, requests, 3)
+	assert.Equal(t, http.StatusTooManyRequests, requests[0].StatusCode)
+	assert.Equal(t, http.StatusNoContent, requests[2].StatusCode)
+}
+
+func TestServer_ResetNext(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.ResetNext(1)
+
+	_, err := push(t, server, []byte(testJsonBody), nil)
+	assert.NotNil(t, err)
+	assert.Empty(t, server.Lines())
+
+	_, err = push(t, server, []byte(testJsonBody), nil)
+	assert.Nil(t, err)
+	assert.Len(t, server.Lines(), 3)
+}
+
+func TestServer_SetLatency(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.SetLatency(100 * time.Millisecond)
+
+	// client gives up
+	client := &http.Client{Timeout: 10 * time.Millisecond}
+	_, err := client.Post(server.URL+PushPath, "application/json", bytes.NewReader([]byte(testJsonBody)))
+	assert.NotNil(t, err)
+
+	// client waits
+	start := time.Now()
+	_, err = push(t, server, []byte(testJsonBody), nil)
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+	assert.Len(t, server.Lines(), 3)
+}
+
+func TestServer_handle_WithInvalidRequest(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	// invalid body
+	resp, err := push(t, server, []byte("ut-invalid"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// invalid method
+	resp, err = http.Get(server.URL + PushPath)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	assert.Len(t, server.Requests(), 2)
+	assert.Empty(t, server.Lines())
+}
@@ -0,0 +1,237 @@
+package rklogger
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// RotationSize rotates output by size with lumberjack, which is default
+const RotationSize = "size"
+
+// OutputConfig is rotation config of one output path in outputs section of config file,
+// fields which are not provided fall back to top level lumberjack config.
+//
+// Path which is neither in outputPaths nor in errorOutputPaths is appended to outputPaths.
+//
+// Rotation could be size, hourly, daily or cron expression, RotatingSyncer is used instead of lumberjack
+// if rotation is time based or pattern is provided, files are named by pattern like logs/app-%Y%m%d.log.
+// Pattern with time directive is required if rotation is time based.
+type OutputConfig struct {
+	Path       string `yaml:"path" json:"path"`
+	Rotation   string `yaml:"rotation" json:"rotation"`
+	Pattern    string `yaml:"pattern" json:"pattern"`
+	MaxSize    *int   `yaml:"maxsize" json:"maxsize"`
+	MaxAge     *int   `yaml:"maxage" json:"maxage"`
+	MaxBackups *int   `yaml:"maxbackups" json:"maxbackups"`
+	LocalTime  *bool  `yaml:"localtime" json:"localtime"`
+	Compress   *bool  `yaml:"compress" json:"compress"`
+}
+
+// Outputs section of config file
+type outputsConfigSection struct {
+	Outputs        []*OutputConfig `yaml:"outputs" json:"outputs"`
+	LenientOutputs bool            `yaml:"lenientOutputs" json:"lenientOutputs"`
+}
+
+// Create lumberjack.Logger of output, unset fields are copied from defaults
+func (output *OutputConfig) lumberjack(defaults *lumberjack.Logger) *lumberjack.Logger {
+	lumber := &lumberjack.Logger{
+		Filename:   output.Path,
+		MaxSize:    defaults.MaxSize,
+		MaxAge:     defaults.MaxAge,
+		MaxBackups: defaults.MaxBackups,
+		LocalTime:  defaults.LocalTime,
+		Compress:   defaults.Compress,
+	}
+
+	if output.MaxSize != nil {
+		lumber.MaxSize = *output.MaxSize
+	}
+	if output.MaxAge != nil {
+		lumber.MaxAge = *output.MaxAge
+	}
+	if output.MaxBackups != nil {
+		lumber.MaxBackups = *output.MaxBackups
+	}
+	if output.LocalTime != nil {
+		lumber.LocalTime = *output.LocalTime
+	}
+	if output.Compress != nil {
+		lumber.Compress = *output.Compress
+	}
+
+	return lumber
+}
+
+// Rotation settings of output resolved with defaults, writers of same file must have equal settings
+type outputSettings struct {
+	schedule   string
+	pattern    string
+	maxSize    int
+	maxAge     int
+	maxBackups int
+	localTime  bool
+	compress   bool
+}
+
+// Resolve settings of output, unset fields are copied from defaults
+func (output *OutputConfig) settings(defaults *lumberjack.Logger) outputSettings {
+	lumber := output.lumberjack(defaults)
+
+	settings := outputSettings{
+		schedule:   output.Rotation,
+		pattern:    output.Pattern,
+		maxSize:    lumber.MaxSize,
+		maxAge:     lumber.MaxAge,
+		maxBackups: lumber.MaxBackups,
+		localTime:  lumber.LocalTime,
+		compress:   lumber.Compress,
+	}
+
+	if settings.schedule == RotationSize {
+		settings.schedule = ""
+	}
+
+	return settings
+}
+
+// Create write syncer of output, unset fields are copied from defaults
+func (output *OutputConfig) syncer(defaults *lumberjack.Logger) (outputSyncer, error) {
+	settings := output.settings(defaults)
+
+	if len(settings.schedule) < 1 && len(settings.pattern) < 1 {
+		return &lumberjackSyncer{Logger: output.lumberjack(defaults)}, nil
+	}
+
+	// files named after path would be rotated by index and path is never written again
+	if len(settings.pattern) < 1 {
+		return nil, fmt.Errorf("rotation %s of output %s requires pattern with time directive", settings.schedule, output.Path)
+	}
+
+	syncer, err := NewRotatingSyncer(settings.pattern,
+		WithRotatingSchedule(settings.schedule),
+		WithRotatingMaxSize(settings.maxSize),
+		WithRotatingMaxAge(settings.maxAge),
+		WithRotatingMaxBackups(settings.maxBackups),
+		WithRotatingLocalTime(settings.localTime),
+		WithRotatingCompress(settings.compress))
+	if err != nil {
+		return nil, err
+	}
+
+	return syncer, nil
+}
+
+// Create write syncer of output and open file at once, so that invalid path is reported before writing
+func (output *OutputConfig) openSyncer(defaults *lumberjack.Logger) (outputSyncer, error) {
+	syncer, err := output.syncer(defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	// files are opened lazily by first write
+	if _, err := syncer.Write(nil); err != nil {
+		syncer.Close()
+		return nil, err
+	}
+
+	return syncer, nil
+}
+
+// File writer which could be closed
+type outputSyncer interface {
+	zapcore.WriteSyncer
+	Close() error
+}
+
+// lumberjack.Logger as zapcore.WriteSyncer, lumberjack writes into file without buffering
+type lumberjackSyncer struct {
+	*lumberjack.Logger
+}
+
+// Sync is noop
+func (syncer *lumberjackSyncer) Sync() error {
+	return nil
+}
+
+// Find output config of path, paths are compared after cleaned
+func findOutputConfig(path string, outputs []*OutputConfig) *OutputConfig {
+	for i := range outputs {
+		if outputs[i] != nil && filepath.Clean(outputs[i].Path) == filepath.Clean(path) {
+			return outputs[i]
+		}
+	}
+
+	return &OutputConfig{Path: path}
+}
+
+// Append output paths which are not listed in config
+func appendOutputPaths(config *zap.Config, outputs []*OutputConfig) {
+	for i := range outputs {
+		if outputs[i] == nil || len(outputs[i].Path) < 1 {
+			continue
+		}
+
+		listed := false
+		for _, paths := range [][]string{config.OutputPaths, config.ErrorOutputPaths} {
+			for j := range paths {
+				if filepath.Clean(paths[j]) == filepath.Clean(outputs[i].Path) {
+					listed = true
+				}
+			}
+		}
+
+		if !listed {
+			config.OutputPaths = append(config.OutputPaths, outputs[i].Path)
+		}
+	}
+}
+
+// Open sinks of paths, stdout and stderr are opened by zap and files are rotated by lumberjack or
+// RotatingSyncer shared with other loggers writing same file. Files are opened by zap without rotation
+// if lumber is nil. Every path is opened, sinks opened are returned with errors of failed ones.
+func newOutputSinks(kind string, paths []string, lumber *lumberjack.Logger, outputs []*OutputConfig) ([]*loggerSink, error) {
+	res := make([]*loggerSink, 0, len(paths))
+	var errs error
+
+	for i := range paths {
+		var sink *loggerSink
+		var err error
+
+		if lumber == nil || paths[i] == "stdout" || paths[i] == "stderr" {
+			sink, err = newZapSink(paths[i])
+		} else {
+			sink, err = newOutputWriterSink(findOutputConfig(paths[i], outputs), lumber)
+		}
+
+		if err != nil {
+			errs = multierr.Append(errs, fmt.Errorf("open %s %s: %w", kind, paths[i], err))
+			continue
+		}
+
+		res = append(res, sink)
+	}
+
+	return res, errs
+}
+
+// Append stderr sink if not opened yet, which is fallback of sinks failed to open
+func appendStderrSink(sinks []*loggerSink) []*loggerSink {
+	for i := range sinks {
+		if sinks[i].name == "stderr" {
+			return sinks
+		}
+	}
+
+	sink, err := newZapSink("stderr")
+	if err != nil {
+		return sinks
+	}
+
+	return append(sinks, sink)
+}
@@ -0,0 +1,161 @@
+package rklogger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Process wide registry of file writers, loggers writing same file share one writer
+// instead of racing on rotation with independent ones
+var outputRegistry = newOutputWriterRegistry()
+
+// OpenOutputWriter returns reference of writer of output from process wide registry, writer is created
+// at first open and shared by later ones with same cleaned absolute path, or same pattern if provided.
+// Error is returned if output is already opened with different rotation settings.
+//
+// Close the returned writer once it is not used anymore, file is closed after every reference closed.
+func OpenOutputWriter(output *OutputConfig, defaults *lumberjack.Logger) (*OutputWriter, error) {
+	return outputRegistry.open(output, defaults)
+}
+
+// Create empty registry
+func newOutputWriterRegistry() *outputWriterRegistry {
+	return &outputWriterRegistry{
+		writers: make(map[string]*sharedOutputWriter),
+	}
+}
+
+// Reference counted writers keyed by cleaned absolute path or pattern
+type outputWriterRegistry struct {
+	writers map[string]*sharedOutputWriter
+	mutex   sync.Mutex
+}
+
+// Writer shared by references
+type sharedOutputWriter struct {
+	key      string
+	settings outputSettings
+	syncer   outputSyncer
+	refs     int
+}
+
+// Open reference of writer, writer is created if not opened yet
+func (registry *outputWriterRegistry) open(output *OutputConfig, defaults *lumberjack.Logger) (*OutputWriter, error) {
+	if output == nil || len(output.Path) < 1 {
+		return nil, errors.New("output path is empty")
+	}
+
+	if defaults == nil {
+		defaults = &lumberjack.Logger{}
+	}
+
+	abs := *output
+	settings := output.settings(defaults)
+
+	// files rotated by pattern are named by it instead of path
+	name := output.Path
+	if len(settings.pattern) > 0 {
+		name = settings.pattern
+	}
+
+	key, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(settings.pattern) > 0 {
+		abs.Pattern, settings.pattern = key, key
+	} else {
+		abs.Path = key
+	}
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	shared, ok := registry.writers[key]
+	if ok {
+		if shared.settings != settings {
+			return nil, fmt.Errorf("output %s is already opened with different rotation settings", key)
+		}
+	} else {
+		syncer, err := abs.openSyncer(defaults)
+		if err != nil {
+			return nil, err
+		}
+
+		shared = &sharedOutputWriter{
+			key:      key,
+			settings: settings,
+			syncer:   syncer,
+		}
+		registry.writers[key] = shared
+	}
+
+	shared.refs++
+
+	return &OutputWriter{
+		shared:   shared,
+		registry: registry,
+	}, nil
+}
+
+// Release reference of writer, writer is closed and removed once no reference left
+func (registry *outputWriterRegistry) release(shared *sharedOutputWriter) error {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	shared.refs--
+	if shared.refs > 0 {
+		return nil
+	}
+
+	delete(registry.writers, shared.key)
+	return shared.syncer.Close()
+}
+
+// OutputWriter is reference of file writer shared by loggers writing same file
+type OutputWriter struct {
+	shared   *sharedOutputWriter
+	registry *outputWriterRegistry
+	closed   int32
+}
+
+// ************* Implementation of zapcore.WriteSyncer *************
+
+// Write p into shared writer
+func (writer *OutputWriter) Write(p []byte) (int, error) {
+	if atomic.LoadInt32(&writer.closed) == 1 {
+		return 0, os.ErrClosed
+	}
+
+	return writer.shared.syncer.Write(p)
+}
+
+// Sync shared writer
+func (writer *OutputWriter) Sync() error {
+	if atomic.LoadInt32(&writer.closed) == 1 {
+		return os.ErrClosed
+	}
+
+	return writer.shared.syncer.Sync()
+}
+
+// Close release reference, file is closed once every reference closed
+func (writer *OutputWriter) Close() error {
+	if !atomic.CompareAndSwapInt32(&writer.closed, 0, 1) {
+		return nil
+	}
+
+	return writer.registry.release(writer.shared)
+}
+
+// Path returns cleaned absolute path of output, or absolute pattern if files are named by pattern
+func (writer *OutputWriter) Path() string {
+	return writer.shared.key
+}
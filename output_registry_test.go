@@ -0,0 +1,183 @@
+package rklogger
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOutputWriterRegistry_open(t *testing.T) {
+	registry := newOutputWriterRegistry()
+	dir := t.TempDir()
+	defaults := &lumberjack.Logger{MaxSize: 1}
+
+	// with invalid output
+	writer, err := registry.open(nil, defaults)
+	assert.Nil(t, writer)
+	assert.NotNil(t, err)
+	writer, err = registry.open(&OutputConfig{}, defaults)
+	assert.Nil(t, writer)
+	assert.NotNil(t, err)
+	writer, err = registry.open(&OutputConfig{Path: filepath.Join(dir, "invalid.log"), Rotation: "weekly"}, defaults)
+	assert.Nil(t, writer)
+	assert.NotNil(t, err)
+	// file could not be opened
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte{}, 0644))
+	writer, err = registry.open(&OutputConfig{Path: filepath.Join(dir, "file", "ut.log")}, defaults)
+	assert.Nil(t, writer)
+	assert.NotNil(t, err)
+	assert.Empty(t, registry.writers)
+
+	// same file is shared
+	first, err := registry.open(&OutputConfig{Path: filepath.Join(dir, "ut.log")}, defaults)
+	assert.Nil(t, err)
+	second, err := registry.open(&OutputConfig{Path: filepath.Join(dir, "sub", "..", "ut.log")}, defaults)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "ut.log"), second.Path())
+	assert.Equal(t, first.shared, second.shared)
+	assert.Equal(t, 2, first.shared.refs)
+
+	// conflicting settings
+	maxSize := 2
+	writer, err = registry.open(&OutputConfig{Path: filepath.Join(dir, "ut.log"), MaxSize: &maxSize}, defaults)
+	assert.Nil(t, writer)
+	assert.NotNil(t, err)
+	writer, err = registry.open(&OutputConfig{Path: filepath.Join(dir, "ut.log"), Rotation: RotatingDaily, Pattern: filepath.Join(dir, "ut-%Y%m%d.log")}, defaults)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(dir, "ut-%Y%m%d.log"), writer.Path())
+
+	// files named by pattern are shared regardless of path
+	pattern, err := registry.open(&OutputConfig{Path: filepath.Join(dir, "other.log"), Rotation: RotatingDaily, Pattern: filepath.Join(dir, "sub", "..", "ut-%Y%m%d.log")}, defaults)
+	assert.Nil(t, err)
+	assert.Equal(t, writer.shared, pattern.shared)
+	pattern, err = registry.open(&OutputConfig{Path: filepath.Join(dir, "other.log"), Rotation: RotatingHourly, Pattern: filepath.Join(dir, "ut-%Y%m%d.log")}, defaults)
+	assert.Nil(t, pattern)
+	assert.NotNil(t, err)
+	assert.Nil(t, writer.Close())
+
+	// same settings in other form
+	writer, err = registry.open(&OutputConfig{Path: filepath.Join(dir, "ut.log"), Rotation: RotationSize}, &lumberjack.Logger{MaxSize: 1})
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+}
+
+func TestOutputWriter_Close(t *testing.T) {
+	registry := newOutputWriterRegistry()
+	path := filepath.Join(t.TempDir(), "ut.log")
+
+	first, _ := registry.open(&OutputConfig{Path: path}, nil)
+	second, _ := registry.open(&OutputConfig{Path: path}, nil)
+
+	_, err := first.Write([]byte("ut-line-1\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, first.Sync())
+
+	// closed reference
+	assert.Nil(t, first.Close())
+	assert.Nil(t, first.Close())
+	assert.Equal(t, 1, second.shared.refs)
+	_, err = first.Write([]byte("ut"))
+	assert.Equal(t, os.ErrClosed, err)
+	assert.Equal(t, os.ErrClosed, first.Sync())
+
+	// others still write
+	_, err = second.Write([]byte("ut-line-2\n"))
+	assert.Nil(t, err)
+
+	// removed once every reference closed
+	assert.Nil(t, second.Close())
+	assert.Empty(t, registry.writers)
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "ut-line-1\nut-line-2\n", string(content))
+
+	// opened again with other settings
+	maxSize := 2
+	writer, err := registry.open(&OutputConfig{Path: path, MaxSize: &maxSize}, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+}
+
+func TestNewLoggerWithConf_WithSharedOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ut.log")
+	config := &zap.Config{
+		Level:            zap.NewAtomicLevelAt(zap.InfoLevel),
+		Encoding:         "console",
+		EncoderConfig:    zap.NewProductionEncoderConfig(),
+		OutputPaths:      []string{path},
+		ErrorOutputPaths: []string{path},
+	}
+
+	first, err := NewLoggerWithConf(config, &lumberjack.Logger{MaxSize: 1})
+	assert.Nil(t, err)
+	second, err := NewLoggerWithConf(config, &lumberjack.Logger{MaxSize: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, outputRegistry.writers[path].refs)
+
+	// loggers write concurrently into same file
+	wait := sync.WaitGroup{}
+	for _, logger := range []*Logger{first, second} {
+		wait.Add(1)
+		go func(logger *Logger) {
+			defer wait.Done()
+			for i := 0; i < 100; i++ {
+				logger.Info("ut-msg")
+			}
+		}(logger)
+	}
+	wait.Wait()
+
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, 200, strings.Count(string(content), "ut-msg"))
+
+	// conflicting settings
+	logger, err := NewLoggerWithConf(config, &lumberjack.Logger{MaxSize: 2})
+	assert.Nil(t, logger)
+	assert.NotNil(t, err)
+	assert.Equal(t, 4, outputRegistry.writers[path].refs)
+
+	// settings could be changed once every logger closed
+	assert.Nil(t, first.Close(context.Background()))
+	assert.Nil(t, second.Close(context.Background()))
+	logger, err = NewLoggerWithConf(config, &lumberjack.Logger{MaxSize: 2})
+	assert.Nil(t, err)
+	assert.Nil(t, logger.Close(context.Background()))
+}
+
+func TestNewZapLoggerWithConf_WithSharedOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ut.log")
+	config := &zap.Config{
+		Level:         zap.NewAtomicLevelAt(zap.InfoLevel),
+		Encoding:      "console",
+		EncoderConfig: zap.NewProductionEncoderConfig(),
+		OutputPaths:   []string{path},
+	}
+
+	// legacy loggers like EventLogger and app logger share writer of same file
+	event, err := NewZapLoggerWithConf(config, &lumberjack.Logger{MaxSize: 1})
+	assert.Nil(t, err)
+	app, err := NewZapLoggerWithConf(config, &lumberjack.Logger{MaxSize: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, outputRegistry.writers[path].refs)
+
+	event.Info("ut-event")
+	app.Info("ut-app")
+	content, _ := ioutil.ReadFile(path)
+	assert.Contains(t, string(content), "ut-event")
+	assert.Contains(t, string(content), "ut-app")
+
+	// conflicting settings
+	logger, err := NewZapLoggerWithConf(config, &lumberjack.Logger{MaxSize: 2})
+	assert.Nil(t, logger)
+	assert.NotNil(t, err)
+	shared, err := NewLoggerWithConf(config, &lumberjack.Logger{MaxSize: 2})
+	assert.Nil(t, shared)
+	assert.NotNil(t, err)
+}
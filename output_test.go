@@ -0,0 +1,158 @@
+package rklogger
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputConfig_lumberjack(t *testing.T) {
+	defaults := &lumberjack.Logger{
+		MaxSize:    1,
+		MaxAge:     7,
+		MaxBackups: 3,
+		LocalTime:  true,
+		Compress:   true,
+	}
+
+	// with defaults
+	lumber := (&OutputConfig{Path: "ut.log"}).lumberjack(defaults)
+	assert.Equal(t, "ut.log", lumber.Filename)
+	assert.Equal(t, 1, lumber.MaxSize)
+	assert.Equal(t, 7, lumber.MaxAge)
+	assert.Equal(t, 3, lumber.MaxBackups)
+	assert.True(t, lumber.LocalTime)
+	assert.True(t, lumber.Compress)
+
+	// with overrides, zero values are kept
+	maxSize, maxAge, maxBackups, disabled := 10, 90, 0, false
+	lumber = (&OutputConfig{
+		Path:       "ut.log",
+		MaxSize:    &maxSize,
+		MaxAge:     &maxAge,
+		MaxBackups: &maxBackups,
+		LocalTime:  &disabled,
+		Compress:   &disabled,
+	}).lumberjack(defaults)
+	assert.Equal(t, 10, lumber.MaxSize)
+	assert.Equal(t, 90, lumber.MaxAge)
+	assert.Equal(t, 0, lumber.MaxBackups)
+	assert.False(t, lumber.LocalTime)
+	assert.False(t, lumber.Compress)
+}
+
+func TestFindOutputConfig(t *testing.T) {
+	maxAge := 90
+	outputs := []*OutputConfig{nil, {Path: "logs/audit.log", MaxAge: &maxAge}}
+
+	assert.Equal(t, &maxAge, findOutputConfig("./logs/audit.log", outputs).MaxAge)
+
+	// not found
+	output := findOutputConfig("logs/debug.log", outputs)
+	assert.Equal(t, "logs/debug.log", output.Path)
+	assert.Nil(t, output.MaxAge)
+}
+
+func TestAppendOutputPaths(t *testing.T) {
+	config := &zap.Config{
+		OutputPaths:      []string{"stdout", "logs/app.log"},
+		ErrorOutputPaths: []string{"logs/error.log"},
+	}
+
+	appendOutputPaths(config, []*OutputConfig{
+		nil,
+		{Path: ""},
+		{Path: "./logs/app.log"},
+		{Path: "logs/error.log"},
+		{Path: "logs/audit.log"},
+	})
+	assert.Equal(t, []string{"stdout", "logs/app.log", "logs/audit.log"}, config.OutputPaths)
+	assert.Equal(t, []string{"logs/error.log"}, config.ErrorOutputPaths)
+}
+
+func TestOutputConfig_syncer(t *testing.T) {
+	maxAge := 90
+	defaults := &lumberjack.Logger{MaxSize: 1, MaxAge: 7, Compress: true}
+
+	// with size rotation
+	for _, rotation := range []string{"", RotationSize} {
+		syncer, err := (&OutputConfig{Path: "ut.log", Rotation: rotation}).syncer(defaults)
+		assert.Nil(t, err)
+		assert.NotNil(t, syncer)
+		assert.IsType(t, &lumberjackSyncer{}, syncer)
+		assert.Nil(t, syncer.Sync())
+	}
+
+	// with time rotation
+	syncer, err := (&OutputConfig{Path: "ut.log", Rotation: RotatingDaily, Pattern: "ut-%Y%m%d.log", MaxAge: &maxAge}).syncer(defaults)
+	assert.Nil(t, err)
+	rotating := syncer.(*RotatingSyncer)
+	assert.Equal(t, "ut-%Y%m%d.log", rotating.pattern)
+	assert.NotNil(t, rotating.boundaries)
+	assert.Equal(t, 1, rotating.maxSize)
+	assert.Equal(t, 90, rotating.maxAge)
+	assert.True(t, rotating.compress)
+
+	// with pattern only
+	syncer, err = (&OutputConfig{Path: "ut.log", Rotation: RotationSize, Pattern: "ut-%Y%m%d.log"}).syncer(defaults)
+	assert.Nil(t, err)
+	assert.Equal(t, "ut-%Y%m%d.log", syncer.(*RotatingSyncer).pattern)
+	assert.Nil(t, syncer.(*RotatingSyncer).boundaries)
+
+	// with invalid rotation
+	syncer, err = (&OutputConfig{Path: "ut.log", Rotation: "weekly", Pattern: "ut-%Y%m%d.log"}).syncer(defaults)
+	assert.Nil(t, syncer)
+	assert.NotNil(t, err)
+
+	// with time rotation but without time directive
+	for _, pattern := range []string{"", "ut.log", "ut-%%.log"} {
+		syncer, err = (&OutputConfig{Path: "ut.log", Rotation: RotatingDaily, Pattern: pattern}).syncer(defaults)
+		assert.Nil(t, syncer)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestNewOutputSinks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ut.log")
+
+	sinks, err := newOutputSinks("output", []string{"stdout", "stderr", path}, &lumberjack.Logger{}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, sinks, 3)
+	assert.IsType(t, &OutputWriter{}, sinks[2].syncer)
+	assert.Nil(t, closeLoggerSinks(context.Background(), sinks))
+
+	sinks, err = newOutputSinks("output", nil, &lumberjack.Logger{}, nil)
+	assert.Nil(t, err)
+	assert.Empty(t, sinks)
+
+	// opened by zap without lumberjack
+	sinks, err = newOutputSinks("output", []string{path}, nil, nil)
+	assert.Nil(t, err)
+	assert.NotContains(t, outputRegistry.writers, path)
+	assert.Nil(t, closeLoggerSinks(context.Background(), sinks))
+
+	// with invalid outputs, every failed sink is reported
+	invalid := filepath.Join(path, "ut.log")
+	sinks, err = newOutputSinks("output", []string{"stdout", path, "ut-invalid.log", invalid}, &lumberjack.Logger{},
+		[]*OutputConfig{{Path: "ut-invalid.log", Rotation: "weekly"}})
+	assert.Len(t, sinks, 2)
+	assert.Len(t, multierr.Errors(err), 2)
+	assert.Contains(t, err.Error(), "open output ut-invalid.log")
+	assert.Contains(t, err.Error(), "open output "+invalid)
+	assert.Nil(t, closeLoggerSinks(context.Background(), sinks))
+	assert.NotContains(t, outputRegistry.writers, invalid)
+}
+
+func TestAppendStderrSink(t *testing.T) {
+	sinks := appendStderrSink(nil)
+	assert.Len(t, sinks, 1)
+	assert.Equal(t, "stderr", sinks[0].name)
+
+	// opened already
+	assert.Len(t, appendStderrSink(sinks), 1)
+}
@@ -6,27 +6,45 @@ import (
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"go.uber.org/multierr"
 )
 
-// isValidLabelName returns true iff name qualified for loki label name
+// isValidLabelName returns true iff name qualified for loki label name, which matches [a-zA-Z_][a-zA-Z0-9_]*
 func isValidLabelName(name string) bool {
 	if len(name) == 0 {
 		return false
 	}
 	for i, b := range name {
-		if !((b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b == '_' || b == ':' || (b >= '0' && b <= '9' && i > 0)) {
+		if !((b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b == '_' || (b >= '0' && b <= '9' && i > 0)) {
 			return false
 		}
 	}
 	return true
 }
 
+// LokiOverflowPolicy decides which entry to drop while buffer of LokiSyncer is full
+type LokiOverflowPolicy string
+
+const (
+	// LokiOverflowDropNewest drops incoming entry
+	LokiOverflowDropNewest LokiOverflowPolicy = "dropNewest"
+	// LokiOverflowDropOldest drops oldest buffered entries until incoming entry fits
+	LokiOverflowDropOldest LokiOverflowPolicy = "dropOldest"
+	// LokiOverflowBlock blocks Write until buffer is flushed or timeout, incoming entry is dropped at timeout
+	LokiOverflowBlock LokiOverflowPolicy = "block"
+)
+
 // LokiSyncerOption options for lokiSyncer
 type LokiSyncerOption func(syncer *LokiSyncer)
 
@@ -69,12 +87,10 @@ func WithLokiClientTls(conf *tls.Config) LokiSyncerOption {
 	}
 }
 
-// WithLokiLabel provide labels, should follow isValidLabelName()
+// WithLokiLabel provide labels, invalid label name is sanitized, label with empty or too long value is rejected
 func WithLokiLabel(key, value string) LokiSyncerOption {
 	return func(syncer *LokiSyncer) {
-		if len(key) > 0 && len(value) > 0 && isValidLabelName(key) {
-			syncer.labels.Set(key, value)
-		}
+		syncer.setLabel(key, value)
 	}
 }
 
@@ -96,53 +112,132 @@ func WithLokiMaxBatchSize(batchSize int) LokiSyncerOption {
 	}
 }
 
+// WithLokiHttpTimeout provide timeout of each push request including reading response, 10 seconds by default
+func WithLokiHttpTimeout(timeout time.Duration) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if timeout > 0 {
+			syncer.httpTimeout = timeout
+		}
+	}
+}
+
+// WithLokiEncoding provide encoding of push request, one of LokiEncodingJson and LokiEncodingProto
+func WithLokiEncoding(encoding LokiEncoding) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if encoding == LokiEncodingJson || encoding == LokiEncodingProto {
+			syncer.encoding = encoding
+		}
+	}
+}
+
+// WithLokiMaxBufferSize provide max number of entries buffered in memory
+func WithLokiMaxBufferSize(size int) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if size > 0 {
+			syncer.buffer.maxLen = size
+		}
+	}
+}
+
+// WithLokiMaxBufferBytes provide max bytes of entries buffered in memory
+func WithLokiMaxBufferBytes(bytes int) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if bytes > 0 {
+			syncer.buffer.maxBytes = bytes
+		}
+	}
+}
+
+// WithLokiOverflowPolicy provide policy applied while buffer is full, blockTimeout is used by LokiOverflowBlock only
+func WithLokiOverflowPolicy(policy LokiOverflowPolicy, blockTimeout time.Duration) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		switch policy {
+		case LokiOverflowDropNewest, LokiOverflowDropOldest:
+			syncer.buffer.policy = policy
+		case LokiOverflowBlock:
+			if blockTimeout > 0 {
+				syncer.buffer.policy = policy
+				syncer.buffer.blockTimeout = blockTimeout
+			}
+		}
+	}
+}
+
 // NewLokiSyncer create new lokiSyncer
 func NewLokiSyncer(opts ...LokiSyncerOption) *LokiSyncer {
 	syncer := &LokiSyncer{
-		addr:           "localhost:3100",
-		path:           "/loki/api/v1/push",
-		labels:         newAtomicMap(),
-		maxBatchWaitMs: 3000 * time.Millisecond,
-		maxBatchSize:   1000,
-		quitChannel:    make(chan struct{}),
-		buffer:         newAtomicSlice(),
+		addr:               "localhost:3100",
+		path:               "/loki/api/v1/push",
+		encoding:           LokiEncodingJson,
+		labels:             newAtomicMap(),
+		headers:            map[string]string{},
+		gzipMinBytes:       1024,
+		metrics:            newLokiMetrics(),
+		maxBatchWaitMs:     3000 * time.Millisecond,
+		maxBatchSize:       1000,
+		quitChannel:        make(chan struct{}),
+		buffer:             newAtomicSlice(),
+		retry:              newLokiRetryPolicy(),
+		spoolMaxBytes:      256 * 1024 * 1024,
+		httpTimeout:        10 * time.Second,
+		endpointStrategy:   LokiEndpointFailover,
+		endpointCooldown:   30 * time.Second,
+		maxLabelValueBytes: 2048,
+		streams: lokiStreamSet{
+			seen: map[string]struct{}{},
+		},
 	}
 
+	// bound buffer by default, so that unreachable loki would not exhaust memory
+	syncer.buffer.maxLen = 100000
+	syncer.buffer.maxBytes = 64 * 1024 * 1024
+
 	for i := range opts {
 		opts[i](syncer)
 	}
 
-	// convert label key if illegal
+	// listener could be provided before circuit breaker
+	if syncer.breaker != nil {
+		syncer.breaker.listener = syncer.circuitListener
+	}
+
+	// notify flusher once batch is full
+	syncer.buffer.flushLen = syncer.maxBatchSize
+	syncer.buffer.flushBytes = syncer.maxBatchBytes
+
+	// validate labels with max label value bytes
+	syncer.initLabels()
+
 	syncer.labels.Set("rk_logger", "v1")
 
 	// init http client
 	syncer.initHttpClient()
 
+	// init endpoints
+	syncer.initEndpoints()
+
 	// init basic auth
 	syncer.initBasicAuth()
 
-	// add wait group
-	syncer.waitGroup.Add(1)
+	// init spool
+	syncer.initSpool()
+
+	// canceled once Interrupt deadline exceeded
+	syncer.ctx, syncer.cancel = context.WithCancel(context.Background())
 
 	return syncer
 }
 
 // Init http client
 func (syncer *LokiSyncer) initHttpClient() {
-	// adjust loki addr
-	strings.TrimPrefix(syncer.addr, "http://")
-	strings.TrimPrefix(syncer.addr, "https://")
-
-	syncer.httpClient = &http.Client{}
+	syncer.httpClient = &http.Client{
+		Timeout: syncer.httpTimeout,
+	}
 
 	if syncer.tlsConfig != nil {
 		syncer.httpClient.Transport = &http.Transport{
 			TLSClientConfig: syncer.tlsConfig,
 		}
-
-		syncer.addr = "https://" + syncer.addr
-	} else {
-		syncer.addr = "http://" + syncer.addr
 	}
 }
 
@@ -154,63 +249,224 @@ func (syncer *LokiSyncer) initBasicAuth() {
 	}
 }
 
+// Init write ahead spool if spool directory provided
+func (syncer *LokiSyncer) initSpool() {
+	if len(syncer.spoolDir) < 1 {
+		return
+	}
+
+	spool, err := newLokiSpool(syncer.spoolDir, syncer.spoolMaxBytes)
+	if err != nil {
+		log.Printf("Failed to init loki spool at %s, spool disabled: %s\n", syncer.spoolDir, err)
+		return
+	}
+
+	syncer.spool = spool
+}
+
 // LokiSyncer which will periodically send logs to Loki
 type LokiSyncer struct {
-	addr            string         `yaml:"addr" json:"addr"`
-	path            string         `yaml:"path" json:"path"`
-	username        string         `yaml:"username" json:"username"`
-	password        string         `yaml:"-" json:"-"`
-	basicAuthHeader string         `yaml:"-" json:"-"`
-	tlsConfig       *tls.Config    `yaml:"-" json:"-"`
-	maxBatchWaitMs  time.Duration  `yaml:"maxBatchWaitMs" json:"maxBatchWaitMs"`
-	maxBatchSize    int            `yaml:"maxBatchSize" json:"maxBatchSize"`
-	labels          *atomicMap     `yaml:"-" json:"-"`
-	buffer          *atomicSlice   `yaml:"-" json:"-"`
-	quitChannel     chan struct{}  `yaml:"-" json:"-"`
-	waitGroup       sync.WaitGroup `yaml:"-" json:"-"`
-	httpClient      *http.Client   `yaml:"-" json:"-"`
+	addr               string                          `yaml:"-" json:"-"`
+	path               string                          `yaml:"-" json:"-"`
+	encoding           LokiEncoding                    `yaml:"-" json:"-"`
+	username           string                          `yaml:"-" json:"-"`
+	password           string                          `yaml:"-" json:"-"`
+	basicAuthHeader    string                          `yaml:"-" json:"-"`
+	tlsConfig          *tls.Config                     `yaml:"-" json:"-"`
+	maxBatchWaitMs     time.Duration                   `yaml:"-" json:"-"`
+	maxBatchSize       int                             `yaml:"-" json:"-"`
+	maxBatchBytes      int                             `yaml:"-" json:"-"`
+	maxLineBytes       int                             `yaml:"-" json:"-"`
+	linePolicy         LokiLinePolicy                  `yaml:"-" json:"-"`
+	labels             *atomicMap                      `yaml:"-" json:"-"`
+	buffer             *atomicSlice                    `yaml:"-" json:"-"`
+	quitChannel        chan struct{}                   `yaml:"-" json:"-"`
+	quitOnce           sync.Once                       `yaml:"-" json:"-"`
+	ctx                context.Context                 `yaml:"-" json:"-"`
+	cancel             context.CancelFunc              `yaml:"-" json:"-"`
+	waitGroup          sync.WaitGroup                  `yaml:"-" json:"-"`
+	httpClient         *http.Client                    `yaml:"-" json:"-"`
+	httpTimeout        time.Duration                   `yaml:"-" json:"-"`
+	endpointAddrs      []string                        `yaml:"-" json:"-"`
+	endpoints          []*lokiEndpoint                 `yaml:"-" json:"-"`
+	endpointStrategy   LokiEndpointStrategy            `yaml:"-" json:"-"`
+	endpointCooldown   time.Duration                   `yaml:"-" json:"-"`
+	breaker            *lokiBreaker                    `yaml:"-" json:"-"`
+	circuitListener    func(from, to LokiCircuitState) `yaml:"-" json:"-"`
+	maxLabelValueBytes int                             `yaml:"-" json:"-"`
+	streams            lokiStreamSet                   `yaml:"-" json:"-"`
+	retry              lokiRetryPolicy                 `yaml:"-" json:"-"`
+	spoolDir           string                          `yaml:"-" json:"-"`
+	spoolMaxBytes      int64                           `yaml:"-" json:"-"`
+	spool              *lokiSpool                      `yaml:"-" json:"-"`
+	tenant             string                          `yaml:"-" json:"-"`
+	headers            map[string]string               `yaml:"-" json:"-"`
+	credentialProvider LokiCredentialProvider          `yaml:"-" json:"-"`
+	gzipLevel          int                             `yaml:"-" json:"-"`
+	gzipMinBytes       int                             `yaml:"-" json:"-"`
+	gzipPool           *sync.Pool                      `yaml:"-" json:"-"`
+	timeKey            string                          `yaml:"-" json:"-"`
+	metrics            *lokiMetrics                    `yaml:"-" json:"-"`
 }
 
 // Send message to remote loki server
 func (syncer *LokiSyncer) send() {
+	syncer.sendContext(syncer.ctx)
+}
+
+// Send message to remote loki server, requests are canceled once ctx is done
+func (syncer *LokiSyncer) sendContext(ctx context.Context) error {
+	if syncer.spool != nil {
+		return syncer.sendWithSpool(ctx, syncer.buffer.snapshotAndClear())
+	}
+
+	// entries stay in buffer untouched while circuit is open, so that writes do not requeue them again and again
+	if syncer.breaker.rejecting() {
+		return errLokiCircuitOpen
+	}
+
+	var errs error
+	kept := make([]*lokiValue, 0)
+	batches := syncer.batches(syncer.buffer.snapshotAndClear())
+	for i := range batches {
+		// keep entries in buffer while circuit is open
+		if !syncer.breaker.allow() {
+			if len(kept) < 1 {
+				errs = multierr.Append(errs, errLokiCircuitOpen)
+			}
+			kept = append(kept, batches[i]...)
+			continue
+		}
+
+		err := syncer.sendValues(ctx, batches[i])
+		if err != nil && syncer.keepable(ctx, err) {
+			kept = append(kept, batches[i]...)
+		}
+		errs = multierr.Append(errs, err)
+	}
+
+	if len(kept) > 0 {
+		syncer.buffer.requeue(kept)
+		log.Printf("Kept %d entries in buffer until loki recovers\n", len(kept))
+	}
+
+	return errs
+}
+
+// Entries left in buffer after final send, like the ones kept while circuit is open, are abandoned and reported in Stats
+func (syncer *LokiSyncer) abandonBuffer() {
 	values := syncer.buffer.snapshotAndClear()
 	if len(values) < 1 {
 		return
 	}
 
-	streams := syncer.newLokiStreamList(values)
+	atomic.AddUint64(&syncer.metrics.entriesAbandoned, uint64(len(values)))
+	log.Printf("Abandoned %d entries kept in buffer on shutdown, circuit state: %s\n", len(values), syncer.CircuitState())
+}
+
+// Split values into batches of same tenant with at most maxBatchSize entries and maxBatchBytes bytes
+func (syncer *LokiSyncer) batches(values []*lokiValue) [][]*lokiValue {
+	res := make([][]*lokiValue, 0)
+
+	groups := syncer.groupByTenant(values)
+	for i := range groups {
+		values := groups[i]
+		for len(values) > 0 {
+			size := syncer.batchLen(values)
+			res = append(res, values[:size])
+			values = values[size:]
+		}
+	}
+
+	return res
+}
+
+// Send values of same tenant to remote loki server, values will be dropped if failed,
+// or abandoned if ctx is done before they were sent. Values are not dropped if error is keepable,
+// caller should keep them in buffer.
+func (syncer *LokiSyncer) sendValues(ctx context.Context, values []*lokiValue) error {
+	err := syncer.push(ctx, syncer.newLokiPayload(values))
+	if err == nil || syncer.keepable(ctx, err) {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		atomic.AddUint64(&syncer.metrics.entriesAbandoned, uint64(len(values)))
+		log.Printf("Abandoned %d entries to loki: %s\n", len(values), err)
+	} else {
+		atomic.AddUint64(&syncer.metrics.entriesDropped, uint64(len(values)))
+		log.Printf("Failed to send %d entries to loki: %s\n", len(values), err)
+	}
+
+	return err
+}
+
+// Send one HTTP request to loki endpoint
+func (syncer *LokiSyncer) pushOnce(ctx context.Context, ep *lokiEndpoint, payload *lokiPayload) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.url+syncer.path, bytes.NewReader(payload.body))
+	if err != nil {
+		return err
+	}
 
-	req, _ := http.NewRequest(http.MethodPost, syncer.addr+syncer.path, bytes.NewBuffer(streams))
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", payload.contentType)
+	if len(payload.contentEncoding) > 0 {
+		req.Header.Set("Content-Encoding", payload.contentEncoding)
+	}
+	if len(payload.tenant) > 0 {
+		req.Header.Set(LokiTenantHeader, payload.tenant)
+	}
+	for k, v := range syncer.headers {
+		req.Header.Set(k, v)
+	}
 	if len(syncer.basicAuthHeader) > 0 {
 		req.Header.Add("Authorization", syncer.basicAuthHeader)
 	}
+	if syncer.credentialProvider != nil {
+		if err := syncer.credentialProvider.Apply(req); err != nil {
+			return err
+		}
+	}
 
+	start := time.Now()
 	resp, err := syncer.httpClient.Do(req)
-
+	syncer.metrics.observeLatency(time.Since(start))
 	if err != nil {
-		log.Printf("Failed to send an HTTP request: %s\n", err)
-		return
+		return err
 	}
-
-	if resp.StatusCode != 204 {
-		log.Printf("Unexpected HTTP status code: %d\n", resp.StatusCode)
-		return
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &lokiPushError{
+			statusCode: resp.StatusCode,
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			message:    strings.TrimSpace(string(message)),
+		}
 	}
+
+	return nil
 }
 
 // ************* Bootstrap & Interrupt *************
 
 // Bootstrap run periodic jobs
 func (syncer *LokiSyncer) Bootstrap(context.Context) {
+	syncer.waitGroup.Add(1)
+
 	go func() {
 		waitChannel := time.NewTimer(syncer.maxBatchWaitMs)
 
 		defer func() {
 			syncer.send()
+			syncer.abandonBuffer()
 			syncer.waitGroup.Done()
 		}()
 
+		// replay segments left by previous process
+		if syncer.spool != nil {
+			syncer.send()
+		}
+
 		for {
 			select {
 			case <-syncer.quitChannel:
@@ -218,63 +474,182 @@ func (syncer *LokiSyncer) Bootstrap(context.Context) {
 			case <-waitChannel.C:
 				syncer.send()
 				waitChannel.Reset(syncer.maxBatchWaitMs)
-			default:
-				if syncer.buffer.len() >= syncer.maxBatchSize {
-					syncer.send()
-					waitChannel.Reset(syncer.maxBatchWaitMs)
+			case <-syncer.buffer.full:
+				syncer.send()
+				// restart timer, drain it if already fired
+				if !waitChannel.Stop() {
+					select {
+					case <-waitChannel.C:
+					default:
+					}
 				}
-				time.Sleep(time.Duration(1) * time.Second)
+				waitChannel.Reset(syncer.maxBatchWaitMs)
 			}
 		}
 	}()
 }
 
-// Interrupt goroutine
-func (syncer *LokiSyncer) Interrupt(context.Context) {
-	close(syncer.quitChannel)
-	syncer.waitGroup.Wait()
+// Interrupt goroutine and send remaining entries, requests in flight are canceled once ctx is done,
+// entries which are not sent by then or kept while circuit is open are abandoned and reported in Stats
+func (syncer *LokiSyncer) Interrupt(ctx context.Context) {
+	syncer.quitOnce.Do(func() {
+		close(syncer.quitChannel)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		syncer.waitGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+		// flusher may have exited meanwhile
+		select {
+		case <-done:
+			return
+		default:
+		}
+	}
+
+	before := atomic.LoadUint64(&syncer.metrics.entriesAbandoned)
+	syncer.cancel()
+
+	// requests and retry backoff return at once after canceled, flusher counts remaining entries as abandoned
+	<-done
+
+	abandoned := atomic.LoadUint64(&syncer.metrics.entriesAbandoned) - before
+	log.Printf("Interrupt loki syncer before entries were sent, abandoned %d entries: %s\n", abandoned, ctx.Err())
 }
 
 // ************* Model *************
 
+// AddLabel add static label to every entry, invalid label name is sanitized,
+// label with empty or too long value is rejected and counted in LabelsRejected of Stats
 func (syncer *LokiSyncer) AddLabel(key, value string) {
-	syncer.labels.Set(key, value)
+	syncer.setLabel(key, value)
+}
+
+// SetLabel is same as AddLabel, error is returned if label has empty or too long value
+func (syncer *LokiSyncer) SetLabel(key, value string) error {
+	return syncer.setLabel(key, value)
+}
+
+// Create payload of values with same tenant, values are marshalled with configured encoding,
+// json body is compressed with gzip if enabled
+func (syncer *LokiSyncer) newLokiPayload(values []*lokiValue) *lokiPayload {
+	list := syncer.newLokiStreamList(values)
+	payload := &lokiPayload{
+		tenant:  syncer.tenantOf(values[0]),
+		entries: len(values),
+	}
+
+	if syncer.encoding == LokiEncodingProto {
+		payload.body = list.marshalProto()
+		payload.contentType = "application/x-protobuf"
+		return payload
+	}
+
+	payload.body, _ = json.Marshal(list)
+	payload.contentType = "application/json"
+	syncer.compress(payload)
+
+	return payload
 }
 
-// Create new lokiStreamList
-func (syncer *LokiSyncer) newLokiStreamList(values []*lokiValue) []byte {
+// Create new lokiStreamList, values with same label set are grouped into one stream sorted by timestamp
+func (syncer *LokiSyncer) newLokiStreamList(values []*lokiValue) *lokiStreamList {
 	msg := &lokiStreamList{
 		Streams: []*lokiStream{},
 	}
 
+	base := syncer.labels.Copy()
+	streams := map[string]*lokiStream{}
+
 	for i := range values {
 		val := values[i]
-		labels := syncer.labels.Copy()
-		for k, v := range val.Labels {
-			labels[k] = v
+		labels := base
+		if len(val.Labels) > 0 {
+			labels = make(map[string]string, len(base)+len(val.Labels))
+			for k, v := range base {
+				labels[k] = v
+			}
+			for k, v := range val.Labels {
+				labels[k] = v
+			}
+		}
+
+		key := lokiLabelString(labels)
+		stream, ok := streams[key]
+		if !ok {
+			stream = &lokiStream{
+				Stream: labels,
+				Values: []*lokiValue{},
+			}
+			streams[key] = stream
+			msg.Streams = append(msg.Streams, stream)
 		}
 
-		msg.Streams = append(msg.Streams, &lokiStream{
-			Stream: labels,
-			Values: [][]string{val.Values},
+		stream.Values = append(stream.Values, val)
+	}
+
+	for i := range msg.Streams {
+		values := msg.Streams[i].Values
+		sort.SliceStable(values, func(i, j int) bool {
+			return values[i].Timestamp.Before(values[j].Timestamp)
 		})
 	}
 
-	bytes, _ := json.Marshal(msg)
+	return msg
+}
 
-	return bytes
+// Encoded push request
+type lokiPayload struct {
+	tenant          string
+	entries         int
+	body            []byte
+	contentType     string
+	contentEncoding string
 }
 
 // Refer https://grafana.com/docs/loki/latest/api/#post-lokiapiv1push
 type lokiValue struct {
-	Values []string          `json:"-"`
-	Labels map[string]string `json:"-"`
+	Timestamp time.Time
+	Line      string
+	Labels    map[string]string
+	Metadata  map[string]string
+	Tenant    string
+}
+
+// Approximate memory size of lokiValue
+func (v *lokiValue) size() int {
+	size := len(v.Line)
+	for k, val := range v.Labels {
+		size += len(k) + len(val)
+	}
+	for k, val := range v.Metadata {
+		size += len(k) + len(val)
+	}
+
+	return size
+}
+
+// MarshalJSON marshals lokiValue as ["<unix epoch in nanoseconds>", "<log line>", {<structured metadata>}],
+// structured metadata is omitted if empty
+func (v *lokiValue) MarshalJSON() ([]byte, error) {
+	if len(v.Metadata) > 0 {
+		return json.Marshal([]interface{}{strconv.FormatInt(v.Timestamp.UnixNano(), 10), v.Line, v.Metadata})
+	}
+
+	return json.Marshal([]string{strconv.FormatInt(v.Timestamp.UnixNano(), 10), v.Line})
 }
 
 // Refer https://grafana.com/docs/loki/latest/api/#post-lokiapiv1push
 type lokiStream struct {
 	Stream map[string]string `json:"stream"`
-	Values [][]string        `json:"values"`
+	Values []*lokiValue      `json:"values"`
 }
 
 // Refer https://grafana.com/docs/loki/latest/api/#post-lokiapiv1push
@@ -286,40 +661,196 @@ type lokiStreamList struct {
 
 // Write to logChannel
 func (syncer *LokiSyncer) Write(p []byte) (n int, err error) {
-	syncer.buffer.add(&lokiValue{
-		Values: []string{fmt.Sprintf("%d", time.Now().UnixNano()), string(p)},
+	syncer.add(&lokiValue{
+		Timestamp: syncer.entryTime(p),
+		Line:      string(p),
 	})
 
 	return len(p), nil
 }
 
-// Noop
+// Add value to buffer, line exceeds maxLineBytes would be truncated or dropped
+func (syncer *LokiSyncer) add(value *lokiValue) {
+	if !syncer.limitLine(value) {
+		return
+	}
+
+	syncer.limitLabels(value)
+
+	if syncer.buffer.add(value) {
+		atomic.AddUint64(&syncer.metrics.entriesBuffered, 1)
+	}
+}
+
+// Add value into buffer without applying overflow policy, returns false if buffer is full
+// and value should be offered again later, values dropped by limits count as accepted
+func (syncer *LokiSyncer) offer(value *lokiValue) bool {
+	if !syncer.limitLine(value) {
+		return true
+	}
+
+	syncer.limitLabels(value)
+
+	added, full := syncer.buffer.offer(value)
+	if added {
+		atomic.AddUint64(&syncer.metrics.entriesBuffered, 1)
+	}
+
+	return !full
+}
+
+// Dropped returns number of entries dropped because buffer is full
+func (syncer *LokiSyncer) Dropped() uint64 {
+	return atomic.LoadUint64(&syncer.buffer.dropped)
+}
+
+// Sync send buffered entries, each request is bounded by HTTP timeout
 func (syncer *LokiSyncer) Sync() error {
-	syncer.send()
-	return nil
+	return syncer.sendContext(syncer.ctx)
+}
+
+// SyncContext send buffered entries, requests in flight are canceled once ctx is done
+// and entries which are not sent by then are abandoned
+func (syncer *LokiSyncer) SyncContext(ctx context.Context) error {
+	return syncer.sendContext(ctx)
 }
 
 func newAtomicSlice() *atomicSlice {
 	return &atomicSlice{
-		buf:   make([]*lokiValue, 0),
-		mutex: sync.Mutex{},
+		buf:    make([]*lokiValue, 0),
+		mutex:  sync.Mutex{},
+		policy: LokiOverflowDropNewest,
+		full:   make(chan struct{}, 1),
 	}
 }
 
+// atomicSlice is a buffer of lokiValue bounded by maxLen and maxBytes, zero means unlimited,
+// full channel is notified once flushLen or flushBytes reached or buffer overflows
 type atomicSlice struct {
-	buf   []*lokiValue
-	mutex sync.Mutex
+	buf          []*lokiValue
+	bytes        int
+	maxLen       int
+	maxBytes     int
+	flushLen     int
+	flushBytes   int
+	policy       LokiOverflowPolicy
+	blockTimeout time.Duration
+	dropped      uint64
+	full         chan struct{}
+	notFull      chan struct{}
+	mutex        sync.Mutex
+}
+
+// Notify flusher without blocking, pending notification is enough
+func (a *atomicSlice) notifyFull() {
+	select {
+	case a.full <- struct{}{}:
+	default:
+	}
 }
 
-func (a *atomicSlice) add(item *lokiValue) {
+// Returns true if item with size could be appended without exceeding limits
+func (a *atomicSlice) fits(size int) bool {
+	if a.maxLen > 0 && len(a.buf)+1 > a.maxLen {
+		return false
+	}
+
+	if a.maxBytes > 0 && a.bytes+size > a.maxBytes {
+		return false
+	}
+
+	return true
+}
+
+// Add item to buffer, overflow policy will be applied if buffer is full, returns false if item dropped
+func (a *atomicSlice) add(item *lokiValue) bool {
 	if item == nil {
-		return
+		return false
+	}
+
+	size := item.size()
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	// item could never fit into buffer
+	if a.maxBytes > 0 && size > a.maxBytes {
+		atomic.AddUint64(&a.dropped, 1)
+		return false
+	}
+
+	var deadline *time.Timer
+	if !a.fits(size) {
+		a.notifyFull()
+	}
+
+	for !a.fits(size) {
+		switch a.policy {
+		case LokiOverflowDropOldest:
+			a.bytes -= a.buf[0].size()
+			a.buf[0] = nil
+			a.buf = a.buf[1:]
+			atomic.AddUint64(&a.dropped, 1)
+		case LokiOverflowBlock:
+			if deadline == nil {
+				deadline = time.NewTimer(a.blockTimeout)
+				defer deadline.Stop()
+			}
+
+			if a.notFull == nil {
+				a.notFull = make(chan struct{})
+			}
+			notFull := a.notFull
+
+			a.mutex.Unlock()
+			select {
+			case <-notFull:
+				a.mutex.Lock()
+			case <-deadline.C:
+				a.mutex.Lock()
+				atomic.AddUint64(&a.dropped, 1)
+				return false
+			}
+		default:
+			atomic.AddUint64(&a.dropped, 1)
+			return false
+		}
 	}
 
+	a.appendItem(item, size)
+	return true
+}
+
+// Add item to buffer only if it fits without applying overflow policy, returns true if buffer is full
+// and item should be offered again later. Item which could never fit into buffer is dropped like add does.
+func (a *atomicSlice) offer(item *lokiValue) (added, full bool) {
+	size := item.size()
+
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
 
+	if a.maxBytes > 0 && size > a.maxBytes {
+		atomic.AddUint64(&a.dropped, 1)
+		return false, false
+	}
+
+	if !a.fits(size) {
+		a.notifyFull()
+		return false, true
+	}
+
+	a.appendItem(item, size)
+	return true, false
+}
+
+// Append item and notify flusher once flush size reached, caller should hold mutex
+func (a *atomicSlice) appendItem(item *lokiValue, size int) {
 	a.buf = append(a.buf, item)
+	a.bytes += size
+
+	if (a.flushLen > 0 && len(a.buf) >= a.flushLen) || (a.flushBytes > 0 && a.bytes >= a.flushBytes) {
+		a.notifyFull()
+	}
 }
 
 func (a *atomicSlice) snapshotAndClear() []*lokiValue {
@@ -332,10 +863,40 @@ func (a *atomicSlice) snapshotAndClear() []*lokiValue {
 	}
 
 	a.buf = make([]*lokiValue, 0)
+	a.bytes = 0
+
+	// wake up writers blocked by full buffer
+	if a.notFull != nil {
+		close(a.notFull)
+		a.notFull = nil
+	}
 
 	return res
 }
 
+// Put values back to head of buffer, oldest values are dropped if limits exceeded
+func (a *atomicSlice) requeue(values []*lokiValue) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	buf := make([]*lokiValue, 0, len(values)+len(a.buf))
+	buf = append(buf, values...)
+	buf = append(buf, a.buf...)
+
+	for i := range values {
+		a.bytes += values[i].size()
+	}
+
+	for len(buf) > 0 && ((a.maxLen > 0 && len(buf) > a.maxLen) || (a.maxBytes > 0 && a.bytes > a.maxBytes)) {
+		a.bytes -= buf[0].size()
+		buf[0] = nil
+		buf = buf[1:]
+		atomic.AddUint64(&a.dropped, 1)
+	}
+
+	a.buf = buf
+}
+
 func (a *atomicSlice) len() int {
 	a.mutex.Lock()
 	defer a.mutex.Unlock()
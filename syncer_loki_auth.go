@@ -0,0 +1,207 @@
+package rklogger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LokiCredentialProvider adds credentials to push request, Apply is called before every request
+type LokiCredentialProvider interface {
+	Apply(req *http.Request) error
+}
+
+// WithLokiHeaders provide extra HTTP headers sent with every push request
+func WithLokiHeaders(headers map[string]string) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		for k, v := range headers {
+			if len(k) > 0 {
+				syncer.headers[k] = v
+			}
+		}
+	}
+}
+
+// WithLokiCredentialProvider provide credential provider, like LokiBearerTokenProvider
+func WithLokiCredentialProvider(provider LokiCredentialProvider) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if provider != nil {
+			syncer.credentialProvider = provider
+		}
+	}
+}
+
+// ************* Static bearer token *************
+
+// NewLokiBearerTokenProvider create provider with static bearer token
+func NewLokiBearerTokenProvider(token string) *LokiBearerTokenProvider {
+	return &LokiBearerTokenProvider{
+		token: token,
+	}
+}
+
+// LokiBearerTokenProvider sets static bearer token as Authorization header
+type LokiBearerTokenProvider struct {
+	token string
+}
+
+// Apply sets Authorization header
+func (provider *LokiBearerTokenProvider) Apply(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+provider.token)
+	return nil
+}
+
+// ************* Token file *************
+
+// NewLokiTokenFileProvider create provider which reads bearer token from file, like kubernetes projected service account token,
+// the file is reread once modification time or size changed
+func NewLokiTokenFileProvider(filePath string) *LokiTokenFileProvider {
+	return &LokiTokenFileProvider{
+		filePath: filePath,
+	}
+}
+
+// LokiTokenFileProvider sets bearer token read from file as Authorization header
+type LokiTokenFileProvider struct {
+	filePath string
+	token    string
+	modTime  time.Time
+	size     int64
+	mutex    sync.Mutex
+}
+
+// Apply sets Authorization header, token file is reread if changed
+func (provider *LokiTokenFileProvider) Apply(req *http.Request) error {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	info, err := os.Stat(provider.filePath)
+	if err != nil {
+		return err
+	}
+
+	if len(provider.token) < 1 || !info.ModTime().Equal(provider.modTime) || info.Size() != provider.size {
+		bytes, err := ioutil.ReadFile(provider.filePath)
+		if err != nil {
+			return err
+		}
+
+		token := strings.TrimSpace(string(bytes))
+		if len(token) < 1 {
+			return fmt.Errorf("token file is empty, filePath:%s", provider.filePath)
+		}
+
+		provider.token = token
+		provider.modTime = info.ModTime()
+		provider.size = info.Size()
+	}
+
+	req.Header.Set("Authorization", "Bearer "+provider.token)
+	return nil
+}
+
+// ************* OAuth2 client credentials *************
+
+// NewLokiOAuth2Provider create provider which fetches access token from tokenURL with OAuth2 client credentials grant,
+// token is cached until it is about to expire
+func NewLokiOAuth2Provider(tokenURL, clientID, clientSecret string, scopes ...string) *LokiOAuth2Provider {
+	return &LokiOAuth2Provider{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// LokiOAuth2Provider sets access token of OAuth2 client credentials grant as Authorization header
+type LokiOAuth2Provider struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+	httpClient   *http.Client
+	token        string
+	expiry       time.Time
+	mutex        sync.Mutex
+}
+
+// Refer https://datatracker.ietf.org/doc/html/rfc6749#section-5.1
+type lokiOAuth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Apply sets Authorization header, access token is fetched if missing or about to expire
+func (provider *LokiOAuth2Provider) Apply(req *http.Request) error {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+
+	// refresh token 30 seconds before expiry
+	if len(provider.token) < 1 || (!provider.expiry.IsZero() && time.Now().Add(30*time.Second).After(provider.expiry)) {
+		if err := provider.refresh(); err != nil {
+			return err
+		}
+	}
+
+	req.Header.Set("Authorization", "Bearer "+provider.token)
+	return nil
+}
+
+// Fetch access token from token endpoint
+func (provider *LokiOAuth2Provider) refresh() error {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(provider.scopes) > 0 {
+		form.Set("scope", strings.Join(provider.scopes, " "))
+	}
+
+	req, err := http.NewRequest(http.MethodPost, provider.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(provider.clientID), url.QueryEscape(provider.clientSecret))
+
+	resp, err := provider.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch oauth2 token, status code: %d, %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	token := &lokiOAuth2Token{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return err
+	}
+
+	if len(token.AccessToken) < 1 {
+		return errors.New("oauth2 token response has no access_token")
+	}
+
+	provider.token = token.AccessToken
+
+	provider.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		provider.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+
+	return nil
+}
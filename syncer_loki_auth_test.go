@@ -0,0 +1,132 @@
+package rklogger
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithLokiHeaders(t *testing.T) {
+	syncer := NewLokiSyncer(WithLokiHeaders(map[string]string{"X-Key": "value", "": "invalid"}))
+	assert.Equal(t, map[string]string{"X-Key": "value"}, syncer.headers)
+}
+
+func TestWithLokiCredentialProvider(t *testing.T) {
+	// default
+	syncer := NewLokiSyncer()
+	assert.Nil(t, syncer.credentialProvider)
+
+	// with provider
+	provider := NewLokiBearerTokenProvider("ut-token")
+	syncer = NewLokiSyncer(WithLokiCredentialProvider(provider))
+	assert.Equal(t, provider, syncer.credentialProvider)
+}
+
+func TestLokiBearerTokenProvider_Apply(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost", nil)
+	assert.Nil(t, NewLokiBearerTokenProvider("ut-token").Apply(req))
+	assert.Equal(t, "Bearer ut-token", req.Header.Get("Authorization"))
+}
+
+func TestLokiTokenFileProvider_Apply(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "token")
+	provider := NewLokiTokenFileProvider(filePath)
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost", nil)
+
+	// missing file
+	assert.NotNil(t, provider.Apply(req))
+
+	// empty file
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte("\n"), 0600))
+	assert.NotNil(t, provider.Apply(req))
+
+	// happy case
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte("token-1\n"), 0600))
+	assert.Nil(t, provider.Apply(req))
+	assert.Equal(t, "Bearer token-1", req.Header.Get("Authorization"))
+
+	// rotated token
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte("token-2\n"), 0600))
+	future := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(filePath, future, future))
+	assert.Nil(t, provider.Apply(req))
+	assert.Equal(t, "Bearer token-2", req.Header.Get("Authorization"))
+}
+
+func TestLokiOAuth2Provider_Apply(t *testing.T) {
+	var counter int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "ut-id", user)
+		assert.Equal(t, "ut-secret", pass)
+		assert.Nil(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "logs:write", r.PostForm.Get("scope"))
+
+		atomic.AddInt32(&counter, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"ut-token","token_type":"bearer","expires_in":3600}`))
+	}))
+	defer server.Close()
+
+	provider := NewLokiOAuth2Provider(server.URL, "ut-id", "ut-secret", "logs:write")
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost", nil)
+
+	assert.Nil(t, provider.Apply(req))
+	assert.Equal(t, "Bearer ut-token", req.Header.Get("Authorization"))
+
+	// cached token
+	assert.Nil(t, provider.Apply(req))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counter))
+
+	// expired token
+	provider.expiry = time.Now()
+	assert.Nil(t, provider.Apply(req))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&counter))
+}
+
+func TestLokiOAuth2Provider_Apply_WithError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost", nil)
+	assert.NotNil(t, NewLokiOAuth2Provider(server.URL, "ut-id", "ut-secret").Apply(req))
+	assert.NotNil(t, NewLokiOAuth2Provider(server.URL+"/empty", "ut-id", "ut-secret").Apply(req))
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
+
+func TestLokiSyncer_pushOnce_WithCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "value", r.Header.Get("X-Key"))
+		assert.Equal(t, "Bearer ut-token", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiHeaders(map[string]string{"X-Key": "value"}),
+		WithLokiCredentialProvider(NewLokiBearerTokenProvider("ut-token")))
+	assert.Nil(t, syncer.pushOnce(context.TODO(), syncer.endpoints[0], &lokiPayload{body: []byte("{}"), contentType: "application/json"}))
+
+	// provider error fails request
+	syncer = NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiCredentialProvider(NewLokiTokenFileProvider(filepath.Join(t.TempDir(), "missing"))))
+	assert.NotNil(t, syncer.pushOnce(context.TODO(), syncer.endpoints[0], &lokiPayload{body: []byte("{}"), contentType: "application/json"}))
+}
@@ -0,0 +1,162 @@
+package rklogger
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// LokiCircuitState is state of LokiSyncer circuit breaker
+type LokiCircuitState string
+
+const (
+	// LokiCircuitClosed sends entries to loki
+	LokiCircuitClosed LokiCircuitState = "closed"
+	// LokiCircuitOpen keeps entries in buffer or spool without network calls
+	LokiCircuitOpen LokiCircuitState = "open"
+	// LokiCircuitHalfOpen allows a single probe request to test whether loki recovered
+	LokiCircuitHalfOpen LokiCircuitState = "halfOpen"
+)
+
+// errLokiCircuitOpen is returned while circuit breaker rejects sending
+var errLokiCircuitOpen = errors.New("loki circuit breaker is open")
+
+// WithLokiCircuitBreaker open circuit after failureThreshold consecutive batches failed with network errors,
+// 429 or 5xx, entries are kept in buffer or spool while circuit is open. After openTimeout, a single probe
+// request is sent, circuit is closed if it succeeds or opened again if it fails.
+func WithLokiCircuitBreaker(failureThreshold int, openTimeout time.Duration) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if failureThreshold > 0 && openTimeout > 0 {
+			syncer.breaker = &lokiBreaker{
+				threshold:   failureThreshold,
+				openTimeout: openTimeout,
+				state:       LokiCircuitClosed,
+			}
+		}
+	}
+}
+
+// WithLokiCircuitStateListener provide listener called synchronously on every state change of circuit breaker,
+// it should not block
+func WithLokiCircuitStateListener(listener func(from, to LokiCircuitState)) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		syncer.circuitListener = listener
+	}
+}
+
+// CircuitState returns state of circuit breaker, LokiCircuitClosed if circuit breaker is disabled
+func (syncer *LokiSyncer) CircuitState() LokiCircuitState {
+	return syncer.breaker.current()
+}
+
+// Circuit breaker of pushing to loki, nil breaker allows everything
+type lokiBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+	state       LokiCircuitState
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	listener    func(from, to LokiCircuitState)
+	mutex       sync.Mutex
+}
+
+// Returns current state
+func (b *lokiBreaker) current() LokiCircuitState {
+	if b == nil {
+		return LokiCircuitClosed
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state
+}
+
+// Returns true if request could be sent, only one probe is allowed in half-open state
+func (b *lokiBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mutex.Lock()
+	from := b.state
+	allowed := true
+	switch b.state {
+	case LokiCircuitOpen:
+		allowed = !time.Now().Before(b.openedAt.Add(b.openTimeout))
+		if allowed {
+			b.state = LokiCircuitHalfOpen
+			b.probing = true
+		}
+	case LokiCircuitHalfOpen:
+		allowed = !b.probing
+		b.probing = true
+	}
+	to := b.state
+	b.mutex.Unlock()
+
+	b.notify(from, to)
+	return allowed
+}
+
+// Returns true while circuit is open and open timeout is not passed yet, state is not changed
+func (b *lokiBreaker) rejecting() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state == LokiCircuitOpen && time.Now().Before(b.openedAt.Add(b.openTimeout))
+}
+
+// Record result of request allowed before, canceled request releases probe without changing state
+func (b *lokiBreaker) record(err error, canceled bool) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	from := b.state
+	switch {
+	case canceled:
+		b.probing = false
+	case err == nil || !isRetryableLokiError(err):
+		// loki is reachable even if payload is rejected
+		b.state = LokiCircuitClosed
+		b.failures = 0
+		b.probing = false
+	default:
+		b.failures++
+		if b.state == LokiCircuitHalfOpen || b.failures >= b.threshold {
+			b.state = LokiCircuitOpen
+			b.openedAt = time.Now()
+			b.probing = false
+		}
+	}
+	to := b.state
+	b.mutex.Unlock()
+
+	b.notify(from, to)
+}
+
+// Log state change and call listener if state changed
+func (b *lokiBreaker) notify(from, to LokiCircuitState) {
+	if from == to {
+		return
+	}
+
+	log.Printf("Loki circuit breaker changed from %s to %s\n", from, to)
+	if b.listener != nil {
+		b.listener(from, to)
+	}
+}
+
+// Returns true if values failed with err should be kept in buffer until loki recovers
+func (syncer *LokiSyncer) keepable(ctx context.Context, err error) bool {
+	return syncer.breaker != nil && ctx.Err() == nil && isRetryableLokiError(err)
+}
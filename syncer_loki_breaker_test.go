@@ -0,0 +1,222 @@
+package rklogger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithLokiCircuitBreaker(t *testing.T) {
+	// disabled by default
+	syncer := NewLokiSyncer()
+	assert.Nil(t, syncer.breaker)
+	assert.Equal(t, LokiCircuitClosed, syncer.CircuitState())
+
+	// with options, listener could be provided first
+	listener := func(from, to LokiCircuitState) {}
+	syncer = NewLokiSyncer(WithLokiCircuitStateListener(listener), WithLokiCircuitBreaker(3, time.Second))
+	assert.Equal(t, 3, syncer.breaker.threshold)
+	assert.Equal(t, time.Second, syncer.breaker.openTimeout)
+	assert.NotNil(t, syncer.breaker.listener)
+
+	// with invalid options
+	syncer = NewLokiSyncer(WithLokiCircuitBreaker(0, time.Second), WithLokiCircuitBreaker(1, 0))
+	assert.Nil(t, syncer.breaker)
+}
+
+func TestLokiBreaker(t *testing.T) {
+	transitions := make([]LokiCircuitState, 0)
+	b := &lokiBreaker{
+		threshold:   2,
+		openTimeout: 50 * time.Millisecond,
+		state:       LokiCircuitClosed,
+		listener: func(from, to LokiCircuitState) {
+			transitions = append(transitions, to)
+		},
+	}
+	unavailable := &lokiPushError{statusCode: http.StatusServiceUnavailable}
+
+	// opened after consecutive failures
+	assert.True(t, b.allow())
+	b.record(unavailable, false)
+	assert.Equal(t, LokiCircuitClosed, b.current())
+	b.record(errors.New("ut-error"), false)
+	assert.Equal(t, LokiCircuitOpen, b.current())
+	assert.False(t, b.allow())
+
+	// single probe after timeout
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, b.allow())
+	assert.Equal(t, LokiCircuitHalfOpen, b.current())
+	assert.False(t, b.allow())
+
+	// canceled probe releases it
+	b.record(nil, true)
+	assert.True(t, b.allow())
+
+	// failed probe opens circuit again
+	b.record(unavailable, false)
+	assert.Equal(t, LokiCircuitOpen, b.current())
+
+	// successful probe closes circuit, rejected payload counts as success
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, b.allow())
+	b.record(&lokiPushError{statusCode: http.StatusBadRequest}, false)
+	assert.Equal(t, LokiCircuitClosed, b.current())
+
+	assert.Equal(t, []LokiCircuitState{
+		LokiCircuitOpen, LokiCircuitHalfOpen, LokiCircuitOpen, LokiCircuitHalfOpen, LokiCircuitClosed,
+	}, transitions)
+
+	// nil breaker allows everything
+	var disabled *lokiBreaker
+	assert.True(t, disabled.allow())
+	disabled.record(unavailable, false)
+	assert.Equal(t, LokiCircuitClosed, disabled.current())
+}
+
+func TestLokiSyncer_send_WithCircuitBreaker(t *testing.T) {
+	var counter int32
+	status := int32(http.StatusServiceUnavailable)
+	server := newEndpointTestServer(&counter, &status)
+	defer server.Close()
+
+	mutex := sync.Mutex{}
+	transitions := make([]LokiCircuitState, 0)
+	syncer := NewLokiSyncer(
+		WithLokiAddr(server.URL),
+		WithLokiMaxBatchSize(1),
+		WithLokiRetryMaxAttempts(1),
+		WithLokiCircuitBreaker(1, 50*time.Millisecond),
+		WithLokiCircuitStateListener(func(from, to LokiCircuitState) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			transitions = append(transitions, to)
+		}))
+
+	// first batch opens circuit, every entry is kept in buffer
+	syncer.Write([]byte("1"))
+	syncer.Write([]byte("2"))
+	assert.NotNil(t, syncer.Sync())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counter))
+	assert.Equal(t, LokiCircuitOpen, syncer.Stats().CircuitState)
+	values := syncer.buffer.snapshotAndClear()
+	assert.Equal(t, "1", values[0].Line)
+	assert.Equal(t, "2", values[1].Line)
+	syncer.buffer.requeue(values)
+
+	// no network calls while circuit is open
+	assert.ErrorIs(t, syncer.Sync(), errLokiCircuitOpen)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counter))
+	assert.Equal(t, 2, syncer.buffer.len())
+
+	// probe succeeds after timeout, rest of entries are sent
+	atomic.StoreInt32(&status, http.StatusNoContent)
+	time.Sleep(60 * time.Millisecond)
+	assert.Nil(t, syncer.Sync())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&counter))
+	assert.Zero(t, syncer.buffer.len())
+	assert.Zero(t, syncer.Stats().EntriesDropped)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	assert.Equal(t, []LokiCircuitState{LokiCircuitOpen, LokiCircuitHalfOpen, LokiCircuitClosed}, transitions)
+}
+
+func TestLokiSyncer_Bootstrap_WithOpenCircuit(t *testing.T) {
+	var counter int32
+	status := int32(http.StatusServiceUnavailable)
+	server := newEndpointTestServer(&counter, &status)
+	defer server.Close()
+
+	output := &bytes.Buffer{}
+	log.SetOutput(output)
+	defer log.SetOutput(os.Stderr)
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(server.URL),
+		WithLokiMaxBatchSize(1),
+		WithLokiMaxBatchWaitMs(time.Hour),
+		WithLokiRetryMaxAttempts(1),
+		WithLokiCircuitBreaker(1, time.Hour))
+
+	syncer.Write([]byte("0"))
+	assert.NotNil(t, syncer.Sync())
+	assert.Equal(t, LokiCircuitOpen, syncer.CircuitState())
+
+	// every write reaches flush size, entries are neither requeued nor logged again
+	syncer.Bootstrap(context.Background())
+	for i := 1; i <= 200; i++ {
+		syncer.Write([]byte(strconv.Itoa(i)))
+	}
+	syncer.Interrupt(context.Background())
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counter))
+	assert.Equal(t, 1, strings.Count(output.String(), "Kept"))
+	assert.Equal(t, 1, strings.Count(output.String(), "Loki circuit breaker changed"))
+
+	// entries kept while circuit is open are abandoned on shutdown
+	assert.Contains(t, output.String(), "Abandoned 201 entries kept in buffer on shutdown, circuit state: open")
+	assert.Equal(t, uint64(201), syncer.Stats().EntriesAbandoned)
+	assert.Zero(t, syncer.Stats().EntriesDropped)
+	assert.Zero(t, syncer.buffer.len())
+}
+
+func TestLokiSyncer_sendWithSpool_WithCircuitBreaker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rk-logger-spool")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var counter int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&counter, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(server.URL),
+		WithLokiSpoolDir(dir),
+		WithLokiRetryMaxAttempts(1),
+		WithLokiCircuitBreaker(1, time.Hour))
+
+	syncer.Write([]byte("1"))
+	syncer.Sync()
+	syncer.Write([]byte("2"))
+	syncer.Sync()
+
+	// segments are kept without network calls
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counter))
+	segments, _ := syncer.spool.segments()
+	assert.Len(t, segments, 2)
+}
+
+func TestAtomicSlice_requeue(t *testing.T) {
+	a := newAtomicSlice()
+	a.maxLen = 3
+	a.add(&lokiValue{Line: "3"})
+
+	a.requeue([]*lokiValue{{Line: "1"}, {Line: "2"}})
+	assert.Equal(t, 3, a.len())
+	assert.Equal(t, 3, a.bytes)
+
+	// oldest entries are dropped
+	a.requeue([]*lokiValue{{Line: "0"}})
+	values := a.snapshotAndClear()
+	assert.Equal(t, "1", values[0].Line)
+	assert.Equal(t, "2", values[1].Line)
+	assert.Equal(t, "3", values[2].Line)
+	assert.Equal(t, uint64(1), a.dropped)
+}
@@ -0,0 +1,184 @@
+package rklogger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// LokiConfig is config of LokiSyncer, which could be provided as loki section of zap+lumberjack config file
+type LokiConfig struct {
+	// Addr is address of loki, like localhost:3100
+	Addr string `yaml:"addr" json:"addr"`
+	// Endpoints are addresses of loki in priority order, overrides Addr
+	Endpoints []string `yaml:"endpoints" json:"endpoints"`
+	// EndpointStrategy is one of failover and duplicate
+	EndpointStrategy string `yaml:"endpointStrategy" json:"endpointStrategy"`
+	// Path is push API path, /loki/api/v1/push by default
+	Path string `yaml:"path" json:"path"`
+	// Labels are static labels of every entry
+	Labels map[string]string `yaml:"labels" json:"labels"`
+	// MaxBatchWaitMs is max milliseconds to wait before batch is sent
+	MaxBatchWaitMs int `yaml:"maxBatchWaitMs" json:"maxBatchWaitMs"`
+	// MaxBatchSize is max number of entries in one batch
+	MaxBatchSize int `yaml:"maxBatchSize" json:"maxBatchSize"`
+	// MaxBatchBytes is max bytes of entries in one batch
+	MaxBatchBytes int `yaml:"maxBatchBytes" json:"maxBatchBytes"`
+	// Encoding is one of json and proto
+	Encoding string `yaml:"encoding" json:"encoding"`
+	// Tenant is value of X-Scope-OrgID header
+	Tenant string `yaml:"tenant" json:"tenant"`
+	// Auth is credentials of loki
+	Auth LokiAuthConfig `yaml:"auth" json:"auth"`
+	// Tls is TLS config of loki client, https is used if provided
+	Tls *LokiTlsConfig `yaml:"tls" json:"tls"`
+}
+
+// LokiAuthConfig is credentials of loki, basic auth and bearer token could not be used together
+type LokiAuthConfig struct {
+	// Username of basic auth
+	Username string `yaml:"username" json:"username"`
+	// Password of basic auth
+	Password string `yaml:"password" json:"password"`
+	// BearerToken is static bearer token
+	BearerToken string `yaml:"bearerToken" json:"bearerToken"`
+	// BearerTokenFile is file of bearer token which is reloaded once changed
+	BearerTokenFile string `yaml:"bearerTokenFile" json:"bearerTokenFile"`
+}
+
+// LokiTlsConfig is TLS config of loki client
+type LokiTlsConfig struct {
+	// CaFile is file of CA certificates to verify loki server, system pool is used if empty
+	CaFile string `yaml:"caFile" json:"caFile"`
+	// CertFile is file of client certificate
+	CertFile string `yaml:"certFile" json:"certFile"`
+	// KeyFile is file of client private key
+	KeyFile string `yaml:"keyFile" json:"keyFile"`
+	// ServerName is used to verify hostname of loki server
+	ServerName string `yaml:"serverName" json:"serverName"`
+	// InsecureSkipVerify skips verification of loki server certificate
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify" json:"insecureSkipVerify"`
+}
+
+// NewLokiSyncerWithConfig create new LokiSyncer from config, opts are applied after config
+func NewLokiSyncerWithConfig(config *LokiConfig, opts ...LokiSyncerOption) (*LokiSyncer, error) {
+	if config == nil {
+		return nil, errors.New("loki config is nil")
+	}
+
+	configOpts, err := config.options()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLokiSyncer(append(configOpts, opts...)...), nil
+}
+
+// Convert config to options
+func (config *LokiConfig) options() ([]LokiSyncerOption, error) {
+	opts := []LokiSyncerOption{
+		WithLokiAddr(config.Addr),
+		WithLokiEndpoints(config.Endpoints...),
+		WithLokiPath(config.Path),
+		WithLokiMaxBatchWaitMs(time.Duration(config.MaxBatchWaitMs) * time.Millisecond),
+		WithLokiMaxBatchSize(config.MaxBatchSize),
+		WithLokiMaxBatchBytes(config.MaxBatchBytes),
+		WithLokiTenant(config.Tenant),
+	}
+
+	for k, v := range config.Labels {
+		opts = append(opts, WithLokiLabel(k, v))
+	}
+
+	switch LokiEndpointStrategy(config.EndpointStrategy) {
+	case "":
+	case LokiEndpointFailover, LokiEndpointDuplicate:
+		opts = append(opts, WithLokiEndpointStrategy(LokiEndpointStrategy(config.EndpointStrategy)))
+	default:
+		return nil, fmt.Errorf("invalid loki endpoint strategy: %s", config.EndpointStrategy)
+	}
+
+	switch LokiEncoding(config.Encoding) {
+	case "":
+	case LokiEncodingJson, LokiEncodingProto:
+		opts = append(opts, WithLokiEncoding(LokiEncoding(config.Encoding)))
+	default:
+		return nil, fmt.Errorf("invalid loki encoding: %s", config.Encoding)
+	}
+
+	authOpts, err := config.Auth.options()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, authOpts...)
+
+	if config.Tls != nil {
+		tlsConfig, err := config.Tls.build()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithLokiClientTls(tlsConfig))
+	}
+
+	return opts, nil
+}
+
+// Convert auth config to options
+func (config *LokiAuthConfig) options() ([]LokiSyncerOption, error) {
+	basic := len(config.Username) > 0 || len(config.Password) > 0
+	if basic && (len(config.BearerToken) > 0 || len(config.BearerTokenFile) > 0) {
+		return nil, errors.New("loki basic auth and bearer token could not be used together")
+	}
+
+	if len(config.BearerToken) > 0 && len(config.BearerTokenFile) > 0 {
+		return nil, errors.New("loki bearerToken and bearerTokenFile could not be used together")
+	}
+
+	opts := []LokiSyncerOption{
+		WithLokiUsername(config.Username),
+		WithLokiPassword(config.Password),
+	}
+
+	if len(config.BearerToken) > 0 {
+		opts = append(opts, WithLokiCredentialProvider(NewLokiBearerTokenProvider(config.BearerToken)))
+	}
+
+	if len(config.BearerTokenFile) > 0 {
+		opts = append(opts, WithLokiCredentialProvider(NewLokiTokenFileProvider(config.BearerTokenFile)))
+	}
+
+	return opts, nil
+}
+
+// Build tls.Config with certificate files
+func (config *LokiTlsConfig) build() (*tls.Config, error) {
+	res := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if len(config.CaFile) > 0 {
+		bytes, err := ioutil.ReadFile(config.CaFile)
+		if err != nil {
+			return nil, err
+		}
+
+		res.RootCAs = x509.NewCertPool()
+		if !res.RootCAs.AppendCertsFromPEM(bytes) {
+			return nil, fmt.Errorf("no valid certificate found in loki caFile: %s", config.CaFile)
+		}
+	}
+
+	if len(config.CertFile) > 0 || len(config.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		res.Certificates = []tls.Certificate{cert}
+	}
+
+	return res, nil
+}
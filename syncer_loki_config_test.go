@@ -0,0 +1,145 @@
+package rklogger
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Write self-signed certificate and key into dir, returns file paths
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ut"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "ut.crt"), filepath.Join(dir, "ut.key")
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	return certFile, keyFile
+}
+
+func TestNewLokiSyncerWithConfig(t *testing.T) {
+	// nil config
+	syncer, err := NewLokiSyncerWithConfig(nil)
+	assert.Nil(t, syncer)
+	assert.NotNil(t, err)
+
+	// with config
+	syncer, err = NewLokiSyncerWithConfig(&LokiConfig{
+		Endpoints:        []string{"ut-addr-1", "ut-addr-2"},
+		EndpointStrategy: "duplicate",
+		Path:             "ut-path",
+		Labels:           map[string]string{"app": "ut"},
+		MaxBatchWaitMs:   100,
+		MaxBatchSize:     10,
+		MaxBatchBytes:    1024,
+		Encoding:         "proto",
+		Tenant:           "ut-tenant",
+		Auth: LokiAuthConfig{
+			Username: "ut-user",
+			Password: "ut-pass",
+		},
+	}, WithLokiMaxBatchSize(20))
+	assert.Nil(t, err)
+	assert.Equal(t, "http://ut-addr-1", syncer.addr)
+	assert.Len(t, syncer.endpoints, 2)
+	assert.Equal(t, LokiEndpointDuplicate, syncer.endpointStrategy)
+	assert.Equal(t, "ut-path", syncer.path)
+	assert.Equal(t, "ut", syncer.labels.Get("app"))
+	assert.Equal(t, 100*time.Millisecond, syncer.maxBatchWaitMs)
+	assert.Equal(t, 20, syncer.maxBatchSize)
+	assert.Equal(t, 1024, syncer.maxBatchBytes)
+	assert.Equal(t, LokiEncodingProto, syncer.encoding)
+	assert.Equal(t, "ut-tenant", syncer.tenant)
+	assert.NotEmpty(t, syncer.basicAuthHeader)
+	assert.Nil(t, syncer.tlsConfig)
+
+	// with defaults
+	syncer, err = NewLokiSyncerWithConfig(&LokiConfig{})
+	assert.Nil(t, err)
+	assert.Equal(t, "http://localhost:3100", syncer.addr)
+	assert.Equal(t, 1000, syncer.maxBatchSize)
+	assert.Equal(t, LokiEncodingJson, syncer.encoding)
+}
+
+func TestNewLokiSyncerWithConfig_WithInvalidConfig(t *testing.T) {
+	configs := []*LokiConfig{
+		{EndpointStrategy: "invalid"},
+		{Encoding: "invalid"},
+		{Auth: LokiAuthConfig{Username: "ut-user", BearerToken: "ut-token"}},
+		{Auth: LokiAuthConfig{BearerToken: "ut-token", BearerTokenFile: "ut-file"}},
+		{Tls: &LokiTlsConfig{CaFile: "not-exist"}},
+		{Tls: &LokiTlsConfig{CertFile: "not-exist", KeyFile: "not-exist"}},
+	}
+
+	for i := range configs {
+		syncer, err := NewLokiSyncerWithConfig(configs[i])
+		assert.Nil(t, syncer)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestLokiAuthConfig_options(t *testing.T) {
+	// bearer token
+	syncer, err := NewLokiSyncerWithConfig(&LokiConfig{Auth: LokiAuthConfig{BearerToken: "ut-token"}})
+	assert.Nil(t, err)
+	assert.IsType(t, &LokiBearerTokenProvider{}, syncer.credentialProvider)
+
+	// bearer token file
+	syncer, err = NewLokiSyncerWithConfig(&LokiConfig{Auth: LokiAuthConfig{BearerTokenFile: "ut-file"}})
+	assert.Nil(t, err)
+	assert.IsType(t, &LokiTokenFileProvider{}, syncer.credentialProvider)
+}
+
+func TestLokiTlsConfig_build(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCert(t, dir)
+
+	// with cert files
+	syncer, err := NewLokiSyncerWithConfig(&LokiConfig{
+		Addr: "ut-addr",
+		Tls: &LokiTlsConfig{
+			CaFile:     certFile,
+			CertFile:   certFile,
+			KeyFile:    keyFile,
+			ServerName: "ut",
+		},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://ut-addr", syncer.addr)
+	assert.NotNil(t, syncer.tlsConfig.RootCAs)
+	assert.Len(t, syncer.tlsConfig.Certificates, 1)
+	assert.Equal(t, "ut", syncer.tlsConfig.ServerName)
+
+	// without certificate in ca file
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "empty.crt"), []byte("ut"), 0600))
+	_, err = (&LokiTlsConfig{CaFile: filepath.Join(dir, "empty.crt")}).build()
+	assert.NotNil(t, err)
+
+	// empty tls section enables https with system pool
+	tlsConfig, err := (&LokiTlsConfig{InsecureSkipVerify: true}).build()
+	assert.Nil(t, err)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+	assert.Nil(t, tlsConfig.RootCAs)
+}
@@ -0,0 +1,198 @@
+package rklogger
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// LokiEndpointStrategy decides how entries are pushed to multiple loki endpoints
+type LokiEndpointStrategy string
+
+const (
+	// LokiEndpointFailover pushes to first healthy endpoint in priority order
+	LokiEndpointFailover LokiEndpointStrategy = "failover"
+	// LokiEndpointDuplicate pushes to every healthy endpoint, endpoints in cooldown miss entries
+	// pushed during cooldown since batch is sent once any endpoint accepted it
+	LokiEndpointDuplicate LokiEndpointStrategy = "duplicate"
+)
+
+// WithLokiEndpoints provide loki addresses in priority order, overrides WithLokiAddr
+func WithLokiEndpoints(addrs ...string) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		res := make([]string, 0, len(addrs))
+		for i := range addrs {
+			if len(addrs[i]) > 0 {
+				res = append(res, addrs[i])
+			}
+		}
+
+		if len(res) > 0 {
+			syncer.endpointAddrs = res
+		}
+	}
+}
+
+// WithLokiEndpointStrategy provide strategy of pushing to multiple endpoints, LokiEndpointFailover by default
+func WithLokiEndpointStrategy(strategy LokiEndpointStrategy) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if strategy == LokiEndpointFailover || strategy == LokiEndpointDuplicate {
+			syncer.endpointStrategy = strategy
+		}
+	}
+}
+
+// WithLokiEndpointCooldown provide duration an endpoint is skipped after failure, 30 seconds by default.
+// Endpoint is tried again once cooldown passed and becomes healthy if push succeeds.
+func WithLokiEndpointCooldown(cooldown time.Duration) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if cooldown > 0 {
+			syncer.endpointCooldown = cooldown
+		}
+	}
+}
+
+// Loki endpoint with failure tracking
+type lokiEndpoint struct {
+	url       string
+	failures  uint64
+	downUntil time.Time
+	mutex     sync.Mutex
+}
+
+// Returns true if endpoint did not fail recently
+func (ep *lokiEndpoint) healthy(now time.Time) bool {
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	return !now.Before(ep.downUntil)
+}
+
+// Skip endpoint until cooldown passed
+func (ep *lokiEndpoint) markFailure(now time.Time, cooldown time.Duration) {
+	atomic.AddUint64(&ep.failures, 1)
+
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	ep.downUntil = now.Add(cooldown)
+}
+
+// Mark endpoint healthy
+func (ep *lokiEndpoint) markSuccess() {
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+
+	ep.downUntil = time.Time{}
+}
+
+// Init endpoints from addresses, scheme is decided by TLS config
+func (syncer *LokiSyncer) initEndpoints() {
+	addrs := syncer.endpointAddrs
+	if len(addrs) < 1 {
+		addrs = []string{syncer.addr}
+	}
+
+	syncer.endpoints = make([]*lokiEndpoint, 0, len(addrs))
+	for i := range addrs {
+		addr := strings.TrimPrefix(addrs[i], "http://")
+		addr = strings.TrimPrefix(addr, "https://")
+
+		if syncer.tlsConfig != nil {
+			addr = "https://" + addr
+		} else {
+			addr = "http://" + addr
+		}
+
+		syncer.endpoints = append(syncer.endpoints, &lokiEndpoint{url: addr})
+	}
+
+	// addr is the primary endpoint
+	syncer.addr = syncer.endpoints[0].url
+}
+
+// Returns healthy endpoints in priority order, or all of them if none is healthy
+func (syncer *LokiSyncer) healthyEndpoints() []*lokiEndpoint {
+	now := time.Now()
+
+	res := make([]*lokiEndpoint, 0, len(syncer.endpoints))
+	for i := range syncer.endpoints {
+		if syncer.endpoints[i].healthy(now) {
+			res = append(res, syncer.endpoints[i])
+		}
+	}
+
+	if len(res) < 1 {
+		return syncer.endpoints
+	}
+
+	return res
+}
+
+// Send one HTTP request to endpoint and track its health, rejected payload does not count as endpoint failure
+func (syncer *LokiSyncer) pushEndpoint(ctx context.Context, ep *lokiEndpoint, payload *lokiPayload) error {
+	err := syncer.pushOnce(ctx, ep, payload)
+	switch {
+	case err == nil:
+		ep.markSuccess()
+	case ctx.Err() == nil && isRetryableLokiError(err):
+		ep.markFailure(time.Now(), syncer.endpointCooldown)
+	}
+
+	return err
+}
+
+// Push payload to first healthy endpoint accepting it
+func (syncer *LokiSyncer) pushFailover(ctx context.Context, payload *lokiPayload) error {
+	var err error
+
+	endpoints := syncer.healthyEndpoints()
+	for i := range endpoints {
+		err = syncer.pushEndpoint(ctx, endpoints[i], payload)
+		// other endpoints would reject payload too
+		if err == nil || ctx.Err() != nil || !isRetryableLokiError(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// Push payload to every healthy endpoint concurrently with retries,
+// succeeds if any endpoint accepted payload
+func (syncer *LokiSyncer) pushDuplicate(ctx context.Context, payload *lokiPayload) error {
+	endpoints := syncer.healthyEndpoints()
+	errs := make([]error, len(endpoints))
+
+	wg := sync.WaitGroup{}
+	for i := range endpoints {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = syncer.retryPush(ctx, func() error {
+				return syncer.pushEndpoint(ctx, endpoints[i], payload)
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	sent := false
+	for i := range errs {
+		if errs[i] == nil {
+			sent = true
+		} else if ctx.Err() == nil {
+			log.Printf("Failed to send %d entries to loki endpoint %s: %s\n", payload.entries, endpoints[i].url, errs[i])
+		}
+	}
+
+	if sent {
+		return nil
+	}
+
+	return multierr.Combine(errs...)
+}
@@ -0,0 +1,166 @@
+package rklogger
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newEndpointTestServer(counter *int32, status *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(counter, 1)
+		w.WriteHeader(int(atomic.LoadInt32(status)))
+	}))
+}
+
+func TestWithLokiEndpoints(t *testing.T) {
+	// default
+	syncer := NewLokiSyncer()
+	assert.Len(t, syncer.endpoints, 1)
+	assert.Equal(t, "http://localhost:3100", syncer.endpoints[0].url)
+	assert.Equal(t, LokiEndpointFailover, syncer.endpointStrategy)
+	assert.Equal(t, 30*time.Second, syncer.endpointCooldown)
+
+	// addr with scheme
+	syncer = NewLokiSyncer(WithLokiAddr("http://ut-addr"))
+	assert.Equal(t, "http://ut-addr", syncer.addr)
+
+	// with options
+	syncer = NewLokiSyncer(
+		WithLokiEndpoints("ut-addr-1", "", "http://ut-addr-2"),
+		WithLokiClientTls(&tls.Config{}),
+		WithLokiEndpointStrategy(LokiEndpointDuplicate),
+		WithLokiEndpointCooldown(time.Second))
+	assert.Len(t, syncer.endpoints, 2)
+	assert.Equal(t, "https://ut-addr-1", syncer.endpoints[0].url)
+	assert.Equal(t, "https://ut-addr-2", syncer.endpoints[1].url)
+	assert.Equal(t, "https://ut-addr-1", syncer.addr)
+	assert.Equal(t, LokiEndpointDuplicate, syncer.endpointStrategy)
+	assert.Equal(t, time.Second, syncer.endpointCooldown)
+
+	// with invalid options
+	syncer = NewLokiSyncer(
+		WithLokiEndpoints(),
+		WithLokiEndpointStrategy("invalid"),
+		WithLokiEndpointCooldown(0))
+	assert.Len(t, syncer.endpoints, 1)
+	assert.Equal(t, LokiEndpointFailover, syncer.endpointStrategy)
+	assert.Equal(t, 30*time.Second, syncer.endpointCooldown)
+}
+
+func TestLokiEndpoint_health(t *testing.T) {
+	ep := &lokiEndpoint{}
+	now := time.Now()
+	assert.True(t, ep.healthy(now))
+
+	ep.markFailure(now, time.Second)
+	assert.False(t, ep.healthy(now))
+	assert.True(t, ep.healthy(now.Add(time.Second)))
+	assert.Equal(t, uint64(1), ep.failures)
+
+	ep.markSuccess()
+	assert.True(t, ep.healthy(now))
+}
+
+func TestLokiSyncer_push_WithFailover(t *testing.T) {
+	var primaryCounter, secondaryCounter int32
+	primaryStatus, secondaryStatus := int32(http.StatusServiceUnavailable), int32(http.StatusNoContent)
+	primary := newEndpointTestServer(&primaryCounter, &primaryStatus)
+	defer primary.Close()
+	secondary := newEndpointTestServer(&secondaryCounter, &secondaryStatus)
+	defer secondary.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiEndpoints(primary.URL, secondary.URL),
+		WithLokiEndpointCooldown(100*time.Millisecond),
+		WithLokiRetryMaxAttempts(1))
+	payload := &lokiPayload{body: []byte("{}"), contentType: "application/json"}
+
+	// fail over to secondary
+	assert.Nil(t, syncer.push(context.TODO(), payload))
+	assert.Equal(t, int32(1), primaryCounter)
+	assert.Equal(t, int32(1), secondaryCounter)
+
+	// primary is skipped during cooldown
+	assert.Nil(t, syncer.push(context.TODO(), payload))
+	assert.Equal(t, int32(1), primaryCounter)
+	assert.Equal(t, int32(2), secondaryCounter)
+	stats := syncer.Stats()
+	assert.False(t, stats.Endpoints[0].Healthy)
+	assert.Equal(t, uint64(1), stats.Endpoints[0].Failures)
+	assert.True(t, stats.Endpoints[1].Healthy)
+
+	// primary recovers after cooldown
+	atomic.StoreInt32(&primaryStatus, http.StatusNoContent)
+	time.Sleep(150 * time.Millisecond)
+	assert.Nil(t, syncer.push(context.TODO(), payload))
+	assert.Equal(t, int32(2), primaryCounter)
+	assert.Equal(t, int32(2), secondaryCounter)
+	assert.True(t, syncer.Stats().Endpoints[0].Healthy)
+
+	// rejected payload is not sent to secondary
+	atomic.StoreInt32(&primaryStatus, http.StatusBadRequest)
+	assert.NotNil(t, syncer.push(context.TODO(), payload))
+	assert.Equal(t, int32(3), primaryCounter)
+	assert.Equal(t, int32(2), secondaryCounter)
+	assert.True(t, syncer.Stats().Endpoints[0].Healthy)
+}
+
+func TestLokiSyncer_push_WithDuplicate(t *testing.T) {
+	var primaryCounter, secondaryCounter int32
+	primaryStatus, secondaryStatus := int32(http.StatusNoContent), int32(http.StatusNoContent)
+	primary := newEndpointTestServer(&primaryCounter, &primaryStatus)
+	defer primary.Close()
+	secondary := newEndpointTestServer(&secondaryCounter, &secondaryStatus)
+	defer secondary.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiEndpoints(primary.URL, secondary.URL),
+		WithLokiEndpointStrategy(LokiEndpointDuplicate),
+		WithLokiRetryMaxAttempts(1))
+	payload := &lokiPayload{entries: 1, body: []byte("{}"), contentType: "application/json"}
+
+	// sent to every endpoint
+	assert.Nil(t, syncer.push(context.TODO(), payload))
+	assert.Equal(t, int32(1), primaryCounter)
+	assert.Equal(t, int32(1), secondaryCounter)
+
+	// succeeds while one endpoint is down
+	atomic.StoreInt32(&secondaryStatus, http.StatusServiceUnavailable)
+	assert.Nil(t, syncer.push(context.TODO(), payload))
+	assert.Equal(t, int32(2), secondaryCounter)
+	assert.False(t, syncer.Stats().Endpoints[1].Healthy)
+
+	// fails once every endpoint is down
+	atomic.StoreInt32(&primaryStatus, http.StatusServiceUnavailable)
+	assert.NotNil(t, syncer.push(context.TODO(), payload))
+	assert.Equal(t, uint64(2), syncer.Stats().EntriesSent)
+}
+
+func TestLokiSyncer_send_WithDuplicateRejected(t *testing.T) {
+	var primaryCounter, secondaryCounter int32
+	primaryStatus, secondaryStatus := int32(http.StatusBadRequest), int32(http.StatusBadRequest)
+	primary := newEndpointTestServer(&primaryCounter, &primaryStatus)
+	defer primary.Close()
+	secondary := newEndpointTestServer(&secondaryCounter, &secondaryStatus)
+	defer secondary.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiEndpoints(primary.URL, secondary.URL),
+		WithLokiEndpointStrategy(LokiEndpointDuplicate),
+		WithLokiCircuitBreaker(1, time.Hour))
+
+	// rejected by every endpoint, dropped without retry and circuit stays closed
+	syncer.Write([]byte("ut-line"))
+	assert.NotNil(t, syncer.Sync())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primaryCounter))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&secondaryCounter))
+	assert.Equal(t, uint64(1), syncer.Stats().EntriesDropped)
+	assert.Equal(t, LokiCircuitClosed, syncer.CircuitState())
+	assert.Zero(t, syncer.buffer.len())
+}
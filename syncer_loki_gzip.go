@@ -0,0 +1,60 @@
+package rklogger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"sync"
+)
+
+// WithLokiGzip compress json push request with gzip level, from gzip.HuffmanOnly to gzip.BestCompression
+func WithLokiGzip(level int) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			return
+		}
+
+		syncer.gzipLevel = level
+		syncer.gzipPool = &sync.Pool{
+			New: func() interface{} {
+				// level is validated above, error would never happen
+				writer, _ := gzip.NewWriterLevel(ioutil.Discard, level)
+				return writer
+			},
+		}
+	}
+}
+
+// WithLokiGzipMinBytes provide min body size to compress, smaller body is sent as it is
+func WithLokiGzipMinBytes(minBytes int) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if minBytes >= 0 {
+			syncer.gzipMinBytes = minBytes
+		}
+	}
+}
+
+// Compress body of payload with pooled gzip writer if enabled and body is not too small,
+// body is kept as it is if compression failed
+func (syncer *LokiSyncer) compress(payload *lokiPayload) {
+	if syncer.gzipPool == nil || len(payload.body) < syncer.gzipMinBytes {
+		return
+	}
+
+	writer := syncer.gzipPool.Get().(*gzip.Writer)
+	defer syncer.gzipPool.Put(writer)
+
+	buf := &bytes.Buffer{}
+	writer.Reset(buf)
+
+	if _, err := writer.Write(payload.body); err != nil {
+		return
+	}
+
+	if err := writer.Close(); err != nil {
+		return
+	}
+
+	payload.body = buf.Bytes()
+	payload.contentEncoding = "gzip"
+}
@@ -0,0 +1,77 @@
+package rklogger
+
+import (
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithLokiGzip(t *testing.T) {
+	// default
+	syncer := NewLokiSyncer()
+	assert.Nil(t, syncer.gzipPool)
+	assert.Equal(t, 1024, syncer.gzipMinBytes)
+
+	// with options
+	syncer = NewLokiSyncer(WithLokiGzip(gzip.BestSpeed), WithLokiGzipMinBytes(0))
+	assert.NotNil(t, syncer.gzipPool)
+	assert.Equal(t, gzip.BestSpeed, syncer.gzipLevel)
+	assert.Equal(t, 0, syncer.gzipMinBytes)
+
+	// with invalid level
+	syncer = NewLokiSyncer(WithLokiGzip(100), WithLokiGzipMinBytes(-1))
+	assert.Nil(t, syncer.gzipPool)
+	assert.Equal(t, 1024, syncer.gzipMinBytes)
+}
+
+func TestLokiSyncer_compress(t *testing.T) {
+	syncer := NewLokiSyncer(WithLokiGzip(gzip.DefaultCompression), WithLokiGzipMinBytes(10))
+
+	// tiny body is not compressed
+	payload := &lokiPayload{body: []byte("{}")}
+	syncer.compress(payload)
+	assert.Equal(t, "{}", string(payload.body))
+	assert.Empty(t, payload.contentEncoding)
+
+	// pooled writers are reused
+	for i := 0; i < 3; i++ {
+		body := strings.Repeat("ut-line", 100)
+		payload = &lokiPayload{body: []byte(body)}
+		syncer.compress(payload)
+		assert.Equal(t, "gzip", payload.contentEncoding)
+		assert.True(t, len(payload.body) < len(body))
+
+		reader, err := gzip.NewReader(strings.NewReader(string(payload.body)))
+		assert.Nil(t, err)
+		decompressed, err := ioutil.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, body, string(decompressed))
+	}
+}
+
+func TestLokiSyncer_send_WithGzip(t *testing.T) {
+	received := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		reader, err := gzip.NewReader(r.Body)
+		assert.Nil(t, err)
+		body, _ := ioutil.ReadAll(reader)
+		received = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiGzip(gzip.BestCompression),
+		WithLokiGzipMinBytes(0))
+	syncer.buffer.add(&lokiValue{Timestamp: time.Now(), Line: "ut-line"})
+	syncer.send()
+
+	assert.Contains(t, received, "ut-line")
+}
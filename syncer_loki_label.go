@@ -0,0 +1,146 @@
+package rklogger
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// WithLokiMaxLabelValueBytes provide max bytes of label value, which should match max_label_value_length of loki,
+// 2048 by default. Static labels exceeding it are rejected, dynamic labels exceeding it are removed from entry.
+func WithLokiMaxLabelValueBytes(bytes int) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if bytes > 0 {
+			syncer.maxLabelValueBytes = bytes
+		}
+	}
+}
+
+// WithLokiMaxStreams provide max number of distinct dynamic label sets during lifetime of syncer,
+// entries with new label set beyond it are sent with static labels only. Unlimited by default.
+func WithLokiMaxStreams(streams int) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if streams > 0 {
+			syncer.streams.max = streams
+		}
+	}
+}
+
+// Sanitize label name as prometheus does, invalid characters are replaced with _,
+// and name starts with digit is prefixed with _
+func sanitizeLabelName(name string) string {
+	if isValidLabelName(name) || len(name) < 1 {
+		return name
+	}
+
+	builder := strings.Builder{}
+	if name[0] >= '0' && name[0] <= '9' {
+		builder.WriteByte('_')
+	}
+
+	for _, b := range name {
+		if (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || b == '_' || (b >= '0' && b <= '9') {
+			builder.WriteRune(b)
+		} else {
+			builder.WriteByte('_')
+		}
+	}
+
+	return builder.String()
+}
+
+// Returns sanitized label name, or error if label could not be sent to loki
+func (syncer *LokiSyncer) checkLabel(key, value string) (string, error) {
+	if len(key) < 1 || len(value) < 1 {
+		return "", fmt.Errorf("empty label name or value, name:%s", key)
+	}
+
+	if syncer.maxLabelValueBytes > 0 && len(value) > syncer.maxLabelValueBytes {
+		return "", fmt.Errorf("label value of %s exceeds %d bytes", key, syncer.maxLabelValueBytes)
+	}
+
+	return sanitizeLabelName(key), nil
+}
+
+// Set static label, label name is sanitized
+func (syncer *LokiSyncer) setLabel(key, value string) error {
+	name, err := syncer.checkLabel(key, value)
+	if err != nil {
+		atomic.AddUint64(&syncer.metrics.labelsRejected, 1)
+		log.Printf("Rejected loki label: %s\n", err)
+		return err
+	}
+
+	if name != key {
+		log.Printf("Sanitized loki label name %s to %s\n", key, name)
+	}
+
+	syncer.labels.Set(name, value)
+	return nil
+}
+
+// Validate static labels provided by options, since max label value bytes could be provided after labels
+func (syncer *LokiSyncer) initLabels() {
+	for k, v := range syncer.labels.Copy() {
+		if _, err := syncer.checkLabel(k, v); err != nil {
+			syncer.labels.Delete(k)
+			atomic.AddUint64(&syncer.metrics.labelsRejected, 1)
+			log.Printf("Rejected loki label: %s\n", err)
+		}
+	}
+}
+
+// Sanitize dynamic labels of value, remove invalid ones and apply cardinality guard
+func (syncer *LokiSyncer) limitLabels(value *lokiValue) {
+	if len(value.Labels) < 1 {
+		return
+	}
+
+	labels := make(map[string]string, len(value.Labels))
+	for k, v := range value.Labels {
+		name, err := syncer.checkLabel(k, v)
+		if err != nil {
+			atomic.AddUint64(&syncer.metrics.labelsRejected, 1)
+			continue
+		}
+		labels[name] = v
+	}
+	value.Labels = labels
+
+	if !syncer.streams.admit(lokiLabelString(labels)) {
+		value.Labels = nil
+		if atomic.AddUint64(&syncer.metrics.streamsLimited, 1) == 1 {
+			log.Printf("Number of loki label sets exceeds %d, new label sets are ignored\n", syncer.streams.max)
+		}
+	}
+}
+
+// Set of label sets seen, bounded by max
+type lokiStreamSet struct {
+	max   int
+	seen  map[string]struct{}
+	mutex sync.Mutex
+}
+
+// Returns true if label set was seen or set is not full yet
+func (s *lokiStreamSet) admit(key string) bool {
+	if s.max < 1 {
+		return true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.seen[key]; ok {
+		return true
+	}
+
+	if len(s.seen) >= s.max {
+		return false
+	}
+
+	s.seen[key] = struct{}{}
+	return true
+}
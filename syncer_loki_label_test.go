@@ -0,0 +1,95 @@
+package rklogger
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeLabelName(t *testing.T) {
+	assert.Equal(t, "ut_key", sanitizeLabelName("ut_key"))
+	assert.Equal(t, "ut_key", sanitizeLabelName("ut-key"))
+	assert.Equal(t, "ut_key_", sanitizeLabelName("ut.key界"))
+	assert.Equal(t, "_1key", sanitizeLabelName("1key"))
+	assert.Equal(t, "app_name", sanitizeLabelName("app:name"))
+	assert.Empty(t, sanitizeLabelName(""))
+}
+
+func TestWithLokiLabel_WithSanitize(t *testing.T) {
+	syncer := NewLokiSyncer(
+		WithLokiLabel("ut-key", "ut-value"),
+		WithLokiLabel("empty", ""),
+		WithLokiLabel("long", strings.Repeat("x", 11)),
+		WithLokiMaxLabelValueBytes(10))
+
+	assert.Equal(t, map[string]string{"ut_key": "ut-value", "rk_logger": "v1"}, syncer.labels.Copy())
+	assert.Equal(t, uint64(2), syncer.Stats().LabelsRejected)
+}
+
+func TestLokiSyncer_AddLabel(t *testing.T) {
+	syncer := NewLokiSyncer(WithLokiMaxLabelValueBytes(10))
+
+	syncer.AddLabel("1key", "ut-value")
+	assert.Equal(t, "ut-value", syncer.labels.Get("_1key"))
+
+	// rejected labels are counted
+	syncer.AddLabel("ut-key", "")
+	assert.Empty(t, syncer.labels.Get("ut_key"))
+	assert.Equal(t, uint64(1), syncer.Stats().LabelsRejected)
+}
+
+func TestLokiSyncer_SetLabel(t *testing.T) {
+	syncer := NewLokiSyncer(WithLokiMaxLabelValueBytes(10))
+
+	assert.Nil(t, syncer.SetLabel("app:name", "ut-value"))
+	assert.Equal(t, "ut-value", syncer.labels.Get("app_name"))
+
+	assert.NotNil(t, syncer.SetLabel("ut-key", ""))
+	assert.NotNil(t, syncer.SetLabel("ut-key", strings.Repeat("x", 11)))
+	assert.Empty(t, syncer.labels.Get("ut_key"))
+	assert.Equal(t, uint64(2), syncer.Stats().LabelsRejected)
+}
+
+func TestLokiSyncer_limitLabels(t *testing.T) {
+	syncer := NewLokiSyncer(WithLokiMaxLabelValueBytes(10))
+
+	value := &lokiValue{Labels: map[string]string{
+		"ut-key": "ut-value",
+		"long":   strings.Repeat("x", 11),
+	}}
+	syncer.limitLabels(value)
+	assert.Equal(t, map[string]string{"ut_key": "ut-value"}, value.Labels)
+	assert.Equal(t, uint64(1), syncer.Stats().LabelsRejected)
+}
+
+func TestLokiSyncer_limitLabels_WithMaxStreams(t *testing.T) {
+	syncer := NewLokiSyncer(WithLokiMaxStreams(2))
+	encoder := zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg"})
+	logger := zap.New(NewLokiCore(syncer, encoder, zapcore.InfoLevel, WithLokiCoreLabelFields("user-id")))
+
+	logger.Info("1", zap.String("user-id", "1"))
+	logger.Info("2", zap.String("user-id", "2"))
+	logger.Info("3", zap.String("user-id", "3"))
+	logger.Info("4", zap.String("user-id", "1"))
+
+	values := syncer.buffer.snapshotAndClear()
+	assert.Len(t, values, 4)
+	assert.Equal(t, map[string]string{"level": "info", "user_id": "1"}, values[0].Labels)
+	assert.Equal(t, map[string]string{"level": "info", "user_id": "2"}, values[1].Labels)
+	assert.Nil(t, values[2].Labels)
+	assert.Equal(t, map[string]string{"level": "info", "user_id": "1"}, values[3].Labels)
+	assert.Equal(t, uint64(1), syncer.Stats().StreamsLimited)
+}
+
+func TestLokiStreamSet_admit(t *testing.T) {
+	// unlimited
+	set := &lokiStreamSet{}
+	assert.True(t, set.admit("1"))
+
+	set = &lokiStreamSet{max: 1, seen: map[string]struct{}{}}
+	assert.True(t, set.admit("1"))
+	assert.True(t, set.admit("1"))
+	assert.False(t, set.admit("2"))
+}
@@ -0,0 +1,121 @@
+package rklogger
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// LokiEncoding is the wire format of push request sent to loki
+type LokiEncoding string
+
+const (
+	// LokiEncodingJson push logs as application/json
+	LokiEncodingJson LokiEncoding = "json"
+	// LokiEncodingProto push logs as snappy compressed logproto.PushRequest
+	LokiEncodingProto LokiEncoding = "proto"
+)
+
+// Field numbers of logproto.PushRequest, logproto.StreamAdapter, logproto.EntryAdapter,
+// logproto.LabelPairAdapter and google.protobuf.Timestamp
+//
+// Refer https://github.com/grafana/loki/blob/main/pkg/push/push.proto
+const (
+	lokiProtoPushRequestStreams   protowire.Number = 1
+	lokiProtoStreamLabels         protowire.Number = 1
+	lokiProtoStreamEntries        protowire.Number = 2
+	lokiProtoEntryTimestamp       protowire.Number = 1
+	lokiProtoEntryLine            protowire.Number = 2
+	lokiProtoEntryMetadata        protowire.Number = 3
+	lokiProtoLabelPairName        protowire.Number = 1
+	lokiProtoLabelPairValue       protowire.Number = 2
+	lokiProtoTimestampSeconds     protowire.Number = 1
+	lokiProtoTimestampNanoseconds protowire.Number = 2
+)
+
+// Convert labels to loki label string with sorted keys, like {k1="v1", k2="v2"}
+func lokiLabelString(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	builder := strings.Builder{}
+	builder.WriteByte('{')
+	for i := range keys {
+		if i > 0 {
+			builder.WriteString(", ")
+		}
+		builder.WriteString(keys[i])
+		builder.WriteByte('=')
+		builder.WriteString(strconv.Quote(labels[keys[i]]))
+	}
+	builder.WriteByte('}')
+
+	return builder.String()
+}
+
+// Marshal lokiStreamList as snappy compressed logproto.PushRequest
+func (list *lokiStreamList) marshalProto() []byte {
+	req := make([]byte, 0)
+
+	for i := range list.Streams {
+		req = protowire.AppendTag(req, lokiProtoPushRequestStreams, protowire.BytesType)
+		req = protowire.AppendBytes(req, list.Streams[i].marshalProto())
+	}
+
+	return snappy.Encode(nil, req)
+}
+
+// Marshal lokiStream as logproto.StreamAdapter
+func (stream *lokiStream) marshalProto() []byte {
+	res := make([]byte, 0)
+	res = protowire.AppendTag(res, lokiProtoStreamLabels, protowire.BytesType)
+	res = protowire.AppendString(res, lokiLabelString(stream.Stream))
+
+	for i := range stream.Values {
+		res = protowire.AppendTag(res, lokiProtoStreamEntries, protowire.BytesType)
+		res = protowire.AppendBytes(res, stream.Values[i].marshalProto())
+	}
+
+	return res
+}
+
+// Marshal lokiValue as logproto.EntryAdapter
+func (v *lokiValue) marshalProto() []byte {
+	ts := make([]byte, 0)
+	ts = protowire.AppendTag(ts, lokiProtoTimestampSeconds, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(v.Timestamp.Unix()))
+	ts = protowire.AppendTag(ts, lokiProtoTimestampNanoseconds, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, uint64(v.Timestamp.Nanosecond()))
+
+	res := make([]byte, 0)
+	res = protowire.AppendTag(res, lokiProtoEntryTimestamp, protowire.BytesType)
+	res = protowire.AppendBytes(res, ts)
+	res = protowire.AppendTag(res, lokiProtoEntryLine, protowire.BytesType)
+	res = protowire.AppendString(res, v.Line)
+
+	// structured metadata sorted by name
+	names := make([]string, 0, len(v.Metadata))
+	for k := range v.Metadata {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for i := range names {
+		pair := make([]byte, 0)
+		pair = protowire.AppendTag(pair, lokiProtoLabelPairName, protowire.BytesType)
+		pair = protowire.AppendString(pair, names[i])
+		pair = protowire.AppendTag(pair, lokiProtoLabelPairValue, protowire.BytesType)
+		pair = protowire.AppendString(pair, v.Metadata[names[i]])
+
+		res = protowire.AppendTag(res, lokiProtoEntryMetadata, protowire.BytesType)
+		res = protowire.AppendBytes(res, pair)
+	}
+
+	return res
+}
@@ -0,0 +1,67 @@
+package rklogger
+
+import (
+	"github.com/rookie-ninja/rk-logger/lokitest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLokiLabelString(t *testing.T) {
+	assert.Equal(t, "{}", lokiLabelString(map[string]string{}))
+	assert.Equal(t, `{a="1", b="x\"y"}`, lokiLabelString(map[string]string{"b": `x"y`, "a": "1"}))
+}
+
+func TestWithLokiEncoding(t *testing.T) {
+	// default
+	syncer := NewLokiSyncer()
+	assert.Equal(t, LokiEncodingJson, syncer.encoding)
+
+	// with proto
+	syncer = NewLokiSyncer(WithLokiEncoding(LokiEncodingProto))
+	assert.Equal(t, LokiEncodingProto, syncer.encoding)
+
+	// with invalid
+	syncer = NewLokiSyncer(WithLokiEncoding("invalid"))
+	assert.Equal(t, LokiEncodingJson, syncer.encoding)
+}
+
+func TestLokiSyncer_send_WithProto(t *testing.T) {
+	server := lokitest.NewServer()
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(server.Addr()),
+		WithLokiEncoding(LokiEncodingProto),
+		WithLokiLabel("app", "ut"))
+	now := time.Unix(1600000000, 123456789)
+	syncer.buffer.add(&lokiValue{Timestamp: now, Line: "ut-line"})
+	syncer.buffer.add(&lokiValue{Timestamp: now, Line: "ut-line-2", Metadata: map[string]string{"traceId": "ut"}})
+	syncer.send()
+
+	assert.Equal(t, "application/x-protobuf", server.Requests()[0].Header.Get("Content-Type"))
+	streams := server.Streams(nil)
+	assert.Len(t, streams, 1)
+	assert.Equal(t, map[string]string{"app": "ut", "rk_logger": "v1"}, streams[0].Labels)
+	assert.Len(t, streams[0].Entries, 2)
+	assert.True(t, now.Equal(streams[0].Entries[0].Timestamp))
+	assert.Equal(t, "ut-line", streams[0].Entries[0].Line)
+	assert.Nil(t, streams[0].Entries[0].Metadata)
+	assert.Equal(t, map[string]string{"traceId": "ut"}, streams[0].Entries[1].Metadata)
+}
+
+func TestLokiSyncer_send_WithJson(t *testing.T) {
+	server := lokitest.NewServer()
+	defer server.Close()
+
+	syncer := NewLokiSyncer(WithLokiAddr(server.Addr()))
+	now := time.Unix(1600000000, 123456789)
+	syncer.buffer.add(&lokiValue{Timestamp: now, Line: "ut-line"})
+	syncer.send()
+
+	assert.Equal(t, "application/json", server.Requests()[0].Header.Get("Content-Type"))
+	streams := server.Streams(map[string]string{"rk_logger": "v1"})
+	assert.Len(t, streams, 1)
+	assert.True(t, now.Equal(streams[0].Entries[0].Timestamp))
+	assert.Equal(t, []string{"ut-line"}, server.Lines())
+}
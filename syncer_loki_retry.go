@@ -0,0 +1,195 @@
+package rklogger
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+// WithLokiRetryMaxAttempts provide max attempts of one push request including the first one, 1 disables retry
+func WithLokiRetryMaxAttempts(attempts int) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if attempts > 0 {
+			syncer.retry.maxAttempts = attempts
+		}
+	}
+}
+
+// WithLokiRetryMaxElapsed provide max elapsed time of one push request including retries
+func WithLokiRetryMaxElapsed(in time.Duration) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if in > 0 {
+			syncer.retry.maxElapsed = in
+		}
+	}
+}
+
+// WithLokiRetryBackoff provide initial and max backoff between retries, backoff doubles after each attempt
+func WithLokiRetryBackoff(initial, max time.Duration) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if initial > 0 && max >= initial {
+			syncer.retry.initialBackoff = initial
+			syncer.retry.maxBackoff = max
+		}
+	}
+}
+
+// Create default retry policy
+func newLokiRetryPolicy() lokiRetryPolicy {
+	return lokiRetryPolicy{
+		maxAttempts:    5,
+		maxElapsed:     30 * time.Second,
+		initialBackoff: 500 * time.Millisecond,
+		maxBackoff:     10 * time.Second,
+	}
+}
+
+// Retry policy of push request, 429 and 5xx responses and network errors will be retried
+type lokiRetryPolicy struct {
+	maxAttempts    int
+	maxElapsed     time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// Calculate jittered exponential backoff before next attempt, attempt starts from 1
+func (policy *lokiRetryPolicy) backoff(attempt int) time.Duration {
+	backoff := policy.initialBackoff
+	for i := 1; i < attempt && backoff < policy.maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > policy.maxBackoff {
+		backoff = policy.maxBackoff
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	// equal jitter, wait at least half of backoff
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// lokiPushError is returned if loki responds with unexpected status code
+type lokiPushError struct {
+	statusCode int
+	retryAfter time.Duration
+	message    string
+}
+
+// Error returns status code and message returned from loki
+func (err *lokiPushError) Error() string {
+	if len(err.message) > 0 {
+		return fmt.Sprintf("unexpected HTTP status code: %d, %s", err.statusCode, err.message)
+	}
+
+	return fmt.Sprintf("unexpected HTTP status code: %d", err.statusCode)
+}
+
+// Returns true if request could be retried, network errors are always retryable.
+// Errors combined from endpoints are retryable if any endpoint failed with retryable error.
+func isRetryableLokiError(err error) bool {
+	if errs := multierr.Errors(err); len(errs) > 1 {
+		for i := range errs {
+			if isRetryableLokiError(errs[i]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	pushErr, ok := err.(*lokiPushError)
+	if !ok {
+		return true
+	}
+
+	return pushErr.statusCode == http.StatusTooManyRequests || pushErr.statusCode >= http.StatusInternalServerError
+}
+
+// Parse Retry-After header which could be either delay seconds or HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if len(value) < 1 {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// Push payload to loki endpoints with strategy, give up once ctx is done
+func (syncer *LokiSyncer) push(ctx context.Context, payload *lokiPayload) error {
+	var err error
+	if syncer.endpointStrategy == LokiEndpointDuplicate && len(syncer.endpoints) > 1 {
+		err = syncer.pushDuplicate(ctx, payload)
+	} else {
+		err = syncer.retryPush(ctx, func() error {
+			return syncer.pushFailover(ctx, payload)
+		})
+	}
+
+	syncer.breaker.record(err, ctx.Err() != nil)
+	if err == nil {
+		atomic.AddUint64(&syncer.metrics.entriesSent, uint64(payload.entries))
+	}
+
+	return err
+}
+
+// Call pushFunc until it succeeds, retry with policy if error is retryable, give up once ctx is done
+func (syncer *LokiSyncer) retryPush(ctx context.Context, pushFunc func() error) error {
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		err := pushFunc()
+		if err == nil {
+			return nil
+		}
+
+		// request was canceled, not failed
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !isRetryableLokiError(err) || attempt >= syncer.retry.maxAttempts {
+			syncer.metrics.batchFailed(err)
+			return err
+		}
+
+		wait := syncer.retry.backoff(attempt)
+		if pushErr, ok := err.(*lokiPushError); ok && pushErr.retryAfter > wait {
+			wait = pushErr.retryAfter
+		}
+
+		if syncer.retry.maxElapsed > 0 && time.Since(start)+wait > syncer.retry.maxElapsed {
+			syncer.metrics.batchFailed(err)
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package rklogger
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/multierr"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Create a loki stand-in which responds with statuses in order, 204 is returned after statuses are consumed
+func newRetryTestServer(counter *int32, header http.Header, statuses ...int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(atomic.AddInt32(counter, 1)) - 1
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+
+		if i < len(statuses) {
+			w.WriteHeader(statuses[i])
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestWithLokiRetryOptions(t *testing.T) {
+	// default
+	syncer := NewLokiSyncer()
+	assert.Equal(t, newLokiRetryPolicy(), syncer.retry)
+
+	// with options
+	syncer = NewLokiSyncer(
+		WithLokiRetryMaxAttempts(3),
+		WithLokiRetryMaxElapsed(time.Second),
+		WithLokiRetryBackoff(time.Millisecond, 10*time.Millisecond))
+	assert.Equal(t, 3, syncer.retry.maxAttempts)
+	assert.Equal(t, time.Second, syncer.retry.maxElapsed)
+	assert.Equal(t, time.Millisecond, syncer.retry.initialBackoff)
+	assert.Equal(t, 10*time.Millisecond, syncer.retry.maxBackoff)
+
+	// with invalid options
+	syncer = NewLokiSyncer(
+		WithLokiRetryMaxAttempts(0),
+		WithLokiRetryMaxElapsed(-1),
+		WithLokiRetryBackoff(time.Second, time.Millisecond))
+	assert.Equal(t, newLokiRetryPolicy(), syncer.retry)
+}
+
+func TestLokiRetryPolicy_backoff(t *testing.T) {
+	policy := &lokiRetryPolicy{
+		initialBackoff: 100 * time.Millisecond,
+		maxBackoff:     time.Second,
+	}
+
+	for i := 0; i < 10; i++ {
+		wait := policy.backoff(1)
+		assert.True(t, wait >= 50*time.Millisecond && wait <= 100*time.Millisecond)
+
+		wait = policy.backoff(3)
+		assert.True(t, wait >= 200*time.Millisecond && wait <= 400*time.Millisecond)
+
+		wait = policy.backoff(10)
+		assert.True(t, wait >= 500*time.Millisecond && wait <= time.Second)
+	}
+
+	assert.Zero(t, (&lokiRetryPolicy{}).backoff(1))
+}
+
+func TestIsRetryableLokiError(t *testing.T) {
+	assert.True(t, isRetryableLokiError(errors.New("connection refused")))
+	assert.True(t, isRetryableLokiError(&lokiPushError{statusCode: http.StatusTooManyRequests}))
+	assert.True(t, isRetryableLokiError(&lokiPushError{statusCode: http.StatusServiceUnavailable}))
+	assert.False(t, isRetryableLokiError(&lokiPushError{statusCode: http.StatusBadRequest}))
+	assert.False(t, isRetryableLokiError(&lokiPushError{statusCode: http.StatusUnauthorized}))
+
+	// combined from endpoints
+	badRequest := &lokiPushError{statusCode: http.StatusBadRequest}
+	assert.False(t, isRetryableLokiError(multierr.Combine(badRequest, badRequest)))
+	assert.True(t, isRetryableLokiError(multierr.Combine(badRequest, errors.New("connection refused"))))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Now()
+
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("invalid", now))
+	assert.Zero(t, parseRetryAfter("-1", now))
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3", now))
+	assert.Equal(t, 10*time.Second, parseRetryAfter(now.Add(10*time.Second).UTC().Format(http.TimeFormat), now.Truncate(time.Second)))
+	assert.Zero(t, parseRetryAfter(now.Add(-10*time.Second).UTC().Format(http.TimeFormat), now))
+}
+
+func TestLokiPushError_Error(t *testing.T) {
+	assert.Equal(t, "unexpected HTTP status code: 400", (&lokiPushError{statusCode: 400}).Error())
+	assert.Equal(t, "unexpected HTTP status code: 400, bad", (&lokiPushError{statusCode: 400, message: "bad"}).Error())
+}
+
+func TestLokiSyncer_push_WithRetry(t *testing.T) {
+	var counter int32
+	server := newRetryTestServer(&counter, nil, http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiRetryBackoff(time.Millisecond, 2*time.Millisecond))
+
+	assert.Nil(t, syncer.push(context.TODO(), &lokiPayload{body: []byte("{}"), contentType: "application/json"}))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&counter))
+}
+
+func TestLokiSyncer_push_WithPermanentError(t *testing.T) {
+	var counter int32
+	server := newRetryTestServer(&counter, nil, http.StatusBadRequest)
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiRetryBackoff(time.Millisecond, 2*time.Millisecond))
+
+	err := syncer.push(context.TODO(), &lokiPayload{body: []byte("{}"), contentType: "application/json"})
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.(*lokiPushError).statusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counter))
+}
+
+func TestLokiSyncer_push_WithMaxAttempts(t *testing.T) {
+	var counter int32
+	server := newRetryTestServer(&counter, nil,
+		http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiRetryMaxAttempts(2),
+		WithLokiRetryBackoff(time.Millisecond, 2*time.Millisecond))
+
+	assert.NotNil(t, syncer.push(context.TODO(), &lokiPayload{body: []byte("{}"), contentType: "application/json"}))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&counter))
+}
+
+func TestLokiSyncer_push_WithRetryAfter(t *testing.T) {
+	var counter int32
+	server := newRetryTestServer(&counter, http.Header{"Retry-After": []string{"1"}}, http.StatusTooManyRequests)
+	defer server.Close()
+
+	// retry after exceeds max elapsed time
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiRetryMaxElapsed(500*time.Millisecond),
+		WithLokiRetryBackoff(time.Millisecond, 2*time.Millisecond))
+
+	assert.NotNil(t, syncer.push(context.TODO(), &lokiPayload{body: []byte("{}"), contentType: "application/json"}))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&counter))
+
+	// retry after is honored
+	atomic.StoreInt32(&counter, 0)
+	syncer = NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiRetryBackoff(time.Millisecond, 2*time.Millisecond))
+
+	start := time.Now()
+	assert.Nil(t, syncer.push(context.TODO(), &lokiPayload{body: []byte("{}"), contentType: "application/json"}))
+	assert.True(t, time.Since(start) >= time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&counter))
+}
@@ -0,0 +1,88 @@
+package rklogger
+
+import (
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// LokiLinePolicy decides how to handle line which exceeds max line bytes
+type LokiLinePolicy string
+
+const (
+	// LokiLineTruncate truncates line to max line bytes
+	LokiLineTruncate LokiLinePolicy = "truncate"
+	// LokiLineDrop drops entry
+	LokiLineDrop LokiLinePolicy = "drop"
+)
+
+// WithLokiMaxBatchBytes provide max bytes of entries in one push request, batch exceeds it is split into
+// several requests. It should be less than grpc_server_max_recv_msg_size and ingestion burst size of loki.
+func WithLokiMaxBatchBytes(bytes int) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if bytes > 0 {
+			syncer.maxBatchBytes = bytes
+		}
+	}
+}
+
+// WithLokiMaxLineBytes provide max bytes of one line, which should match max_line_size of loki,
+// line exceeds it is truncated or dropped with policy
+func WithLokiMaxLineBytes(bytes int, policy LokiLinePolicy) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if bytes > 0 && (policy == LokiLineTruncate || policy == LokiLineDrop) {
+			syncer.maxLineBytes = bytes
+			syncer.linePolicy = policy
+		}
+	}
+}
+
+// Returns number of leading values fit into one batch, batch contains at least one value
+func (syncer *LokiSyncer) batchLen(values []*lokiValue) int {
+	size := len(values)
+	if syncer.maxBatchSize > 0 && size > syncer.maxBatchSize {
+		size = syncer.maxBatchSize
+	}
+
+	if syncer.maxBatchBytes > 0 {
+		bytes := 0
+		for i := 0; i < size; i++ {
+			bytes += values[i].size()
+			if bytes > syncer.maxBatchBytes && i > 0 {
+				return i
+			}
+		}
+	}
+
+	return size
+}
+
+// Apply line policy if line exceeds maxLineBytes, returns false if value dropped
+func (syncer *LokiSyncer) limitLine(value *lokiValue) bool {
+	if syncer.maxLineBytes < 1 || len(value.Line) <= syncer.maxLineBytes {
+		return true
+	}
+
+	if syncer.linePolicy == LokiLineDrop {
+		atomic.AddUint64(&syncer.metrics.linesDropped, 1)
+		atomic.AddUint64(&syncer.metrics.entriesDropped, 1)
+		return false
+	}
+
+	value.Line = truncateUtf8(value.Line, syncer.maxLineBytes)
+	atomic.AddUint64(&syncer.metrics.linesTruncated, 1)
+	return true
+}
+
+// Truncate string to at most max bytes without splitting multi-byte rune
+func truncateUtf8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+
+	end := max
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+
+	return s[:end]
+}
@@ -0,0 +1,81 @@
+package rklogger
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestWithLokiMaxBatchBytes(t *testing.T) {
+	// default
+	syncer := NewLokiSyncer()
+	assert.Zero(t, syncer.maxBatchBytes)
+
+	// with option
+	syncer = NewLokiSyncer(WithLokiMaxBatchBytes(1024))
+	assert.Equal(t, 1024, syncer.maxBatchBytes)
+	assert.Equal(t, 1024, syncer.buffer.flushBytes)
+
+	// with invalid option
+	syncer = NewLokiSyncer(WithLokiMaxBatchBytes(-1))
+	assert.Zero(t, syncer.maxBatchBytes)
+}
+
+func TestWithLokiMaxLineBytes(t *testing.T) {
+	// with option
+	syncer := NewLokiSyncer(WithLokiMaxLineBytes(10, LokiLineDrop))
+	assert.Equal(t, 10, syncer.maxLineBytes)
+	assert.Equal(t, LokiLineDrop, syncer.linePolicy)
+
+	// with invalid options
+	syncer = NewLokiSyncer(WithLokiMaxLineBytes(0, LokiLineDrop), WithLokiMaxLineBytes(10, "invalid"))
+	assert.Zero(t, syncer.maxLineBytes)
+}
+
+func TestLokiSyncer_batches_WithMaxBatchBytes(t *testing.T) {
+	syncer := NewLokiSyncer(WithLokiMaxBatchSize(3), WithLokiMaxBatchBytes(4))
+
+	batches := syncer.batches([]*lokiValue{
+		{Line: "12"}, {Line: "34"}, {Line: "5"}, {Line: "123456"}, {Line: "7"}, {Line: "8"}, {Line: "9"}, {Line: "0"},
+	})
+
+	// oversized value is sent alone, batch size is respected too
+	assert.Len(t, batches, 5)
+	assert.Len(t, batches[0], 2)
+	assert.Len(t, batches[1], 1)
+	assert.Equal(t, "123456", batches[2][0].Line)
+	assert.Len(t, batches[2], 1)
+	assert.Len(t, batches[3], 3)
+	assert.Len(t, batches[4], 1)
+}
+
+func TestLokiSyncer_Write_WithMaxLineBytes(t *testing.T) {
+	// truncate
+	syncer := NewLokiSyncer(WithLokiMaxLineBytes(5, LokiLineTruncate))
+	syncer.Write([]byte("ut-line"))
+	syncer.Write([]byte("ut"))
+	values := syncer.buffer.snapshotAndClear()
+	assert.Equal(t, "ut-li", values[0].Line)
+	assert.Equal(t, "ut", values[1].Line)
+	assert.Equal(t, uint64(1), syncer.Stats().LinesTruncated)
+
+	// drop
+	syncer = NewLokiSyncer(WithLokiMaxLineBytes(5, LokiLineDrop))
+	syncer.Write([]byte("ut-line"))
+	syncer.Write([]byte("ut"))
+	values = syncer.buffer.snapshotAndClear()
+	assert.Len(t, values, 1)
+	assert.Equal(t, "ut", values[0].Line)
+	assert.Equal(t, uint64(1), syncer.Stats().LinesDropped)
+	assert.Equal(t, uint64(1), syncer.Stats().EntriesDropped)
+	assert.Equal(t, uint64(1), syncer.Stats().EntriesBuffered)
+}
+
+func TestTruncateUtf8(t *testing.T) {
+	assert.Equal(t, "ut", truncateUtf8("ut", 5))
+	assert.Equal(t, "ut-li", truncateUtf8("ut-line", 5))
+
+	// multi-byte rune is not split
+	assert.Equal(t, "ut", truncateUtf8("ut界", 4))
+	assert.Equal(t, "ut界", truncateUtf8("ut界"+strings.Repeat("x", 3), 5))
+}
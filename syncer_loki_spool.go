@@ -0,0 +1,274 @@
+package rklogger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/multierr"
+)
+
+const lokiSpoolSegmentSuffix = ".seg"
+
+// WithLokiSpoolDir provide directory where batches are persisted before sending,
+// segments left in directory will be replayed on Bootstrap.
+//
+// Entries are persisted per batch at flush, entries accepted by Write but not flushed yet,
+// which are at most maxBatchSize entries or entries of last maxBatchWaitMs, are kept in memory only
+// and lost if process crashes.
+func WithLokiSpoolDir(dir string) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if len(dir) > 0 {
+			syncer.spoolDir = dir
+		}
+	}
+}
+
+// WithLokiSpoolMaxBytes provide max on disk size of spool directory, oldest segments will be evicted first
+func WithLokiSpoolMaxBytes(maxBytes int64) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		if maxBytes > 0 {
+			syncer.spoolMaxBytes = maxBytes
+		}
+	}
+}
+
+// Record of lokiValue persisted in segment file
+type lokiSpoolRecord struct {
+	Timestamp int64             `json:"ts"`
+	Line      string            `json:"line"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Tenant    string            `json:"tenant,omitempty"`
+}
+
+// Create lokiSpool in dir, directory will be created if missing
+func newLokiSpool(dir string, maxBytes int64) (*lokiSpool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	spool := &lokiSpool{
+		dir:      dir,
+		maxBytes: maxBytes,
+	}
+
+	segments, err := spool.segments()
+	if err != nil {
+		return nil, err
+	}
+
+	// continue sequence of existing segments
+	if len(segments) > 0 {
+		spool.seq, _ = strconv.ParseUint(strings.TrimSuffix(segments[len(segments)-1], lokiSpoolSegmentSuffix), 10, 64)
+	}
+
+	return spool, nil
+}
+
+// Write ahead spool of batches, each batch is persisted as one segment file named by sequence
+type lokiSpool struct {
+	dir        string
+	maxBytes   int64
+	seq        uint64
+	evicted    uint64
+	mutex      sync.Mutex
+	drainMutex sync.Mutex
+}
+
+// List segment file names in spool directory, oldest first
+func (spool *lokiSpool) segments() ([]string, error) {
+	files, err := ioutil.ReadDir(spool.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0)
+	for i := range files {
+		if !files[i].IsDir() && strings.HasSuffix(files[i].Name(), lokiSpoolSegmentSuffix) {
+			res = append(res, files[i].Name())
+		}
+	}
+
+	// file names are zero padded sequence, so that lexical order is the same as sequence order
+	sort.Strings(res)
+
+	return res, nil
+}
+
+// Persist values as a new segment and evict oldest segments if max bytes exceeded
+func (spool *lokiSpool) write(values []*lokiValue) error {
+	records := make([]*lokiSpoolRecord, 0, len(values))
+	for i := range values {
+		records = append(records, &lokiSpoolRecord{
+			Timestamp: values[i].Timestamp.UnixNano(),
+			Line:      values[i].Line,
+			Labels:    values[i].Labels,
+			Metadata:  values[i].Metadata,
+			Tenant:    values[i].Tenant,
+		})
+	}
+
+	bytes, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+
+	spool.seq++
+	name := filepath.Join(spool.dir, fmt.Sprintf("%020d%s", spool.seq, lokiSpoolSegmentSuffix))
+
+	// write to temp file first, so that partial segment would never be replayed
+	if err := ioutil.WriteFile(name+".tmp", bytes, 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+
+	spool.evict()
+
+	return nil
+}
+
+// Remove oldest segments until total size is under max bytes, the newest segment is always kept
+func (spool *lokiSpool) evict() {
+	if spool.maxBytes < 1 {
+		return
+	}
+
+	files, err := ioutil.ReadDir(spool.dir)
+	if err != nil {
+		return
+	}
+
+	segments := make([]os.FileInfo, 0)
+	total := int64(0)
+	for i := range files {
+		if !files[i].IsDir() && strings.HasSuffix(files[i].Name(), lokiSpoolSegmentSuffix) {
+			segments = append(segments, files[i])
+			total += files[i].Size()
+		}
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Name() < segments[j].Name()
+	})
+
+	for i := 0; i < len(segments)-1 && total > spool.maxBytes; i++ {
+		// count entries before removing, unreadable segment is counted as empty
+		values, _ := spool.read(segments[i].Name())
+
+		if err := os.Remove(filepath.Join(spool.dir, segments[i].Name())); err == nil {
+			total -= segments[i].Size()
+			atomic.AddUint64(&spool.evicted, uint64(len(values)))
+			log.Printf("Evicted loki spool segment %s with %d entries since spool exceeds %d bytes\n",
+				segments[i].Name(), len(values), spool.maxBytes)
+		}
+	}
+}
+
+// Read values from segment
+func (spool *lokiSpool) read(name string) ([]*lokiValue, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(spool.dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*lokiSpoolRecord, 0)
+	if err := json.Unmarshal(bytes, &records); err != nil {
+		return nil, err
+	}
+
+	values := make([]*lokiValue, 0, len(records))
+	for i := range records {
+		values = append(values, &lokiValue{
+			Timestamp: time.Unix(0, records[i].Timestamp),
+			Line:      records[i].Line,
+			Labels:    records[i].Labels,
+			Metadata:  records[i].Metadata,
+			Tenant:    records[i].Tenant,
+		})
+	}
+
+	return values, nil
+}
+
+// Remove segment
+func (spool *lokiSpool) remove(name string) {
+	if err := os.Remove(filepath.Join(spool.dir, name)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove loki spool segment %s: %s\n", name, err)
+	}
+}
+
+// Persist values into spool as one segment per batch and send every segment oldest first,
+// stop at first retryable failure so that remaining segments could be sent at next flush
+func (syncer *LokiSyncer) sendWithSpool(ctx context.Context, values []*lokiValue) error {
+	var errs error
+	batches := syncer.batches(values)
+	for i := range batches {
+		if err := syncer.spool.write(batches[i]); err != nil {
+			log.Printf("Failed to write loki spool segment, send directly: %s\n", err)
+			err := syncer.sendValues(ctx, batches[i])
+			if err != nil && syncer.keepable(ctx, err) {
+				syncer.buffer.requeue(batches[i])
+			}
+			errs = multierr.Append(errs, err)
+		}
+	}
+
+	syncer.spool.drainMutex.Lock()
+	defer syncer.spool.drainMutex.Unlock()
+
+	segments, err := syncer.spool.segments()
+	if err != nil {
+		log.Printf("Failed to list loki spool segments: %s\n", err)
+		return multierr.Append(errs, err)
+	}
+
+	for i := range segments {
+		values, err := syncer.spool.read(segments[i])
+		if err != nil {
+			// segment may have been evicted meanwhile
+			if !os.IsNotExist(err) {
+				log.Printf("Dropped unreadable loki spool segment %s: %s\n", segments[i], err)
+				syncer.spool.remove(segments[i])
+			}
+			continue
+		}
+
+		// keep segments while circuit is open
+		if !syncer.breaker.allow() {
+			return multierr.Append(errs, errLokiCircuitOpen)
+		}
+
+		if err := syncer.push(ctx, syncer.newLokiPayload(values)); err != nil {
+			if isRetryableLokiError(err) {
+				log.Printf("Failed to send loki spool segment %s, will retry later: %s\n", segments[i], err)
+				return multierr.Append(errs, err)
+			}
+
+			errs = multierr.Append(errs, err)
+
+			atomic.AddUint64(&syncer.metrics.entriesDropped, uint64(len(values)))
+			log.Printf("Dropped loki spool segment %s with %d entries: %s\n", segments[i], len(values), err)
+		}
+
+		syncer.spool.remove(segments[i])
+	}
+
+	return errs
+}
@@ -0,0 +1,160 @@
+package rklogger
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithLokiSpoolOptions(t *testing.T) {
+	dir := t.TempDir()
+
+	// default
+	syncer := NewLokiSyncer()
+	assert.Nil(t, syncer.spool)
+
+	// with options
+	syncer = NewLokiSyncer(WithLokiSpoolDir(dir), WithLokiSpoolMaxBytes(1024))
+	assert.NotNil(t, syncer.spool)
+	assert.Equal(t, dir, syncer.spool.dir)
+	assert.Equal(t, int64(1024), syncer.spool.maxBytes)
+
+	// with invalid directory
+	file := filepath.Join(dir, "file")
+	assert.Nil(t, ioutil.WriteFile(file, []byte{}, 0644))
+	syncer = NewLokiSyncer(WithLokiSpoolDir(file))
+	assert.Nil(t, syncer.spool)
+}
+
+func TestLokiSpool_writeAndRead(t *testing.T) {
+	spool, err := newLokiSpool(t.TempDir(), 0)
+	assert.Nil(t, err)
+
+	now := time.Unix(1600000000, 123456789)
+	assert.Nil(t, spool.write([]*lokiValue{{Timestamp: now, Line: "ut-line", Labels: map[string]string{"k": "v"}}}))
+	assert.Nil(t, spool.write([]*lokiValue{{Timestamp: now, Line: "ut-line-2"}}))
+
+	segments, err := spool.segments()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"00000000000000000001.seg", "00000000000000000002.seg"}, segments)
+
+	values, err := spool.read(segments[0])
+	assert.Nil(t, err)
+	assert.Len(t, values, 1)
+	assert.True(t, now.Equal(values[0].Timestamp))
+	assert.Equal(t, "ut-line", values[0].Line)
+	assert.Equal(t, map[string]string{"k": "v"}, values[0].Labels)
+
+	// sequence continues after reopen
+	spool, err = newLokiSpool(spool.dir, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), spool.seq)
+}
+
+func TestLokiSpool_evict(t *testing.T) {
+	spool, err := newLokiSpool(t.TempDir(), 1)
+	assert.Nil(t, err)
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, spool.write([]*lokiValue{{Timestamp: time.Now(), Line: "ut-line"}}))
+	}
+
+	// only the newest segment is kept
+	segments, err := spool.segments()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"00000000000000000003.seg"}, segments)
+	assert.Equal(t, uint64(2), spool.evicted)
+}
+
+func TestLokiSyncer_Stats_WithEvictedSegments(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(down.URL, "http://")),
+		WithLokiSpoolDir(t.TempDir()),
+		WithLokiSpoolMaxBytes(1),
+		WithLokiRetryMaxAttempts(1))
+
+	for i := 0; i < 3; i++ {
+		syncer.Write([]byte("ut-line"))
+		syncer.Sync()
+	}
+
+	// entries of evicted segments are dropped
+	assert.Equal(t, uint64(2), syncer.Stats().EntriesDropped)
+}
+
+func TestLokiSyncer_sendWithSpool(t *testing.T) {
+	dir := t.TempDir()
+
+	// loki is down, batches stay in spool
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(down.URL, "http://")),
+		WithLokiSpoolDir(dir),
+		WithLokiRetryMaxAttempts(1))
+	syncer.Write([]byte("ut-line-1"))
+	syncer.send()
+	syncer.Write([]byte("ut-line-2"))
+	syncer.send()
+
+	segments, err := syncer.spool.segments()
+	assert.Nil(t, err)
+	assert.Len(t, segments, 2)
+
+	// replayed on next bootstrap
+	var received int32
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Contains(t, string(body), "ut-line-")
+		atomic.AddInt32(&received, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer up.Close()
+
+	syncer = NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(up.URL, "http://")),
+		WithLokiSpoolDir(dir))
+	syncer.Bootstrap(context.TODO())
+	syncer.Interrupt(context.TODO())
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&received))
+	segments, err = syncer.spool.segments()
+	assert.Nil(t, err)
+	assert.Empty(t, segments)
+}
+
+func TestLokiSyncer_sendWithSpool_WithPermanentError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiSpoolDir(t.TempDir()))
+	syncer.Write([]byte("ut-line"))
+	syncer.send()
+
+	// rejected segment is dropped
+	segments, err := syncer.spool.segments()
+	assert.Nil(t, err)
+	assert.Empty(t, segments)
+
+	// unreadable segment is dropped
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(syncer.spool.dir, "00000000000000000009.seg"), []byte("invalid"), 0644))
+	syncer.send()
+	_, err = os.Stat(filepath.Join(syncer.spool.dir, "00000000000000000009.seg"))
+	assert.True(t, os.IsNotExist(err))
+}
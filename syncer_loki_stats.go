@@ -0,0 +1,163 @@
+package rklogger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Upper bounds in seconds of request latency histogram, fixed since metrics are sized by it
+var lokiLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// LokiStats is a snapshot of LokiSyncer counters and gauges
+type LokiStats struct {
+	// EntriesBuffered is number of entries accepted into buffer
+	EntriesBuffered uint64 `json:"entriesBuffered" yaml:"entriesBuffered"`
+	// EntriesSent is number of entries accepted by loki
+	EntriesSent uint64 `json:"entriesSent" yaml:"entriesSent"`
+	// EntriesDropped is number of entries dropped because buffer is full, batch failed permanently
+	// or spool segment is evicted
+	EntriesDropped uint64 `json:"entriesDropped" yaml:"entriesDropped"`
+	// EntriesAbandoned is number of entries not sent before context of Interrupt or SyncContext is done
+	EntriesAbandoned uint64 `json:"entriesAbandoned" yaml:"entriesAbandoned"`
+	// LinesTruncated is number of lines truncated to max line bytes
+	LinesTruncated uint64 `json:"linesTruncated" yaml:"linesTruncated"`
+	// LinesDropped is number of entries dropped since line exceeds max line bytes, which are counted in EntriesDropped too
+	LinesDropped uint64 `json:"linesDropped" yaml:"linesDropped"`
+	// LabelsRejected is number of labels rejected since value is empty or too long
+	LabelsRejected uint64 `json:"labelsRejected" yaml:"labelsRejected"`
+	// StreamsLimited is number of entries sent with static labels only since max streams reached
+	StreamsLimited uint64 `json:"streamsLimited" yaml:"streamsLimited"`
+	// BatchesFailed is number of failed batches by HTTP status code, 0 stands for network errors
+	BatchesFailed map[int]uint64 `json:"batchesFailed" yaml:"batchesFailed"`
+	// RequestLatency is histogram of push request latency
+	RequestLatency LokiLatencyHistogram `json:"requestLatency" yaml:"requestLatency"`
+	// BufferDepth is number of entries currently buffered
+	BufferDepth int `json:"bufferDepth" yaml:"bufferDepth"`
+	// CircuitState is state of circuit breaker
+	CircuitState LokiCircuitState `json:"circuitState" yaml:"circuitState"`
+	// Endpoints are health of loki endpoints in priority order
+	Endpoints []LokiEndpointStats `json:"endpoints" yaml:"endpoints"`
+}
+
+// LokiEndpointStats is health of one loki endpoint
+type LokiEndpointStats struct {
+	// Url of endpoint
+	Url string `json:"url" yaml:"url"`
+	// Healthy is false while endpoint is skipped after failure
+	Healthy bool `json:"healthy" yaml:"healthy"`
+	// Failures is number of failed requests to endpoint, rejected payloads are not counted
+	Failures uint64 `json:"failures" yaml:"failures"`
+}
+
+// LokiLatencyHistogram is histogram of push request latency in seconds
+type LokiLatencyHistogram struct {
+	// Buckets are cumulative counts of requests whose latency is less or equal to upper bound of lokiLatencyBuckets
+	Buckets map[float64]uint64 `json:"buckets" yaml:"buckets"`
+	// Count is number of requests
+	Count uint64 `json:"count" yaml:"count"`
+	// Sum is total latency in seconds
+	Sum float64 `json:"sum" yaml:"sum"`
+}
+
+// Create new lokiMetrics
+func newLokiMetrics() *lokiMetrics {
+	return &lokiMetrics{
+		batchesFailed: map[int]uint64{},
+		latencyCounts: make([]uint64, len(lokiLatencyBuckets)),
+	}
+}
+
+// Counters of LokiSyncer
+type lokiMetrics struct {
+	entriesBuffered  uint64
+	entriesSent      uint64
+	entriesDropped   uint64
+	entriesAbandoned uint64
+	linesTruncated   uint64
+	linesDropped     uint64
+	labelsRejected   uint64
+	streamsLimited   uint64
+	batchesFailed    map[int]uint64
+	latencyCounts    []uint64
+	latencyCount     uint64
+	latencySum       float64
+	mutex            sync.Mutex
+}
+
+// Record latency of one push request
+func (m *lokiMetrics) observeLatency(elapsed time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	seconds := elapsed.Seconds()
+	for i := range lokiLatencyBuckets {
+		if seconds <= lokiLatencyBuckets[i] {
+			m.latencyCounts[i]++
+		}
+	}
+	m.latencyCount++
+	m.latencySum += seconds
+}
+
+// Record failed batch by status code of error
+func (m *lokiMetrics) batchFailed(err error) {
+	code := 0
+	if pushErr, ok := err.(*lokiPushError); ok {
+		code = pushErr.statusCode
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.batchesFailed[code]++
+}
+
+// Stats returns snapshot of counters and gauges
+func (syncer *LokiSyncer) Stats() LokiStats {
+	stats := LokiStats{
+		EntriesBuffered:  atomic.LoadUint64(&syncer.metrics.entriesBuffered),
+		EntriesSent:      atomic.LoadUint64(&syncer.metrics.entriesSent),
+		EntriesDropped:   atomic.LoadUint64(&syncer.metrics.entriesDropped) + atomic.LoadUint64(&syncer.buffer.dropped),
+		EntriesAbandoned: atomic.LoadUint64(&syncer.metrics.entriesAbandoned),
+		LinesTruncated:   atomic.LoadUint64(&syncer.metrics.linesTruncated),
+		LinesDropped:     atomic.LoadUint64(&syncer.metrics.linesDropped),
+		LabelsRejected:   atomic.LoadUint64(&syncer.metrics.labelsRejected),
+		StreamsLimited:   atomic.LoadUint64(&syncer.metrics.streamsLimited),
+		BatchesFailed:    map[int]uint64{},
+		RequestLatency: LokiLatencyHistogram{
+			Buckets: map[float64]uint64{},
+		},
+		BufferDepth:  syncer.buffer.len(),
+		CircuitState: syncer.CircuitState(),
+		Endpoints:    make([]LokiEndpointStats, 0, len(syncer.endpoints)),
+	}
+
+	if syncer.spool != nil {
+		stats.EntriesDropped += atomic.LoadUint64(&syncer.spool.evicted)
+	}
+
+	now := time.Now()
+	for _, ep := range syncer.endpoints {
+		stats.Endpoints = append(stats.Endpoints, LokiEndpointStats{
+			Url:      ep.url,
+			Healthy:  ep.healthy(now),
+			Failures: atomic.LoadUint64(&ep.failures),
+		})
+	}
+
+	syncer.metrics.mutex.Lock()
+	defer syncer.metrics.mutex.Unlock()
+
+	for k, v := range syncer.metrics.batchesFailed {
+		stats.BatchesFailed[k] = v
+	}
+
+	for i := range lokiLatencyBuckets {
+		stats.RequestLatency.Buckets[lokiLatencyBuckets[i]] = syncer.metrics.latencyCounts[i]
+	}
+	stats.RequestLatency.Count = syncer.metrics.latencyCount
+	stats.RequestLatency.Sum = syncer.metrics.latencySum
+
+	return stats
+}
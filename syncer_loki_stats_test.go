@@ -0,0 +1,60 @@
+package rklogger
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLokiSyncer_Stats(t *testing.T) {
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiMaxBufferSize(2))
+
+	// buffered and dropped by overflow
+	syncer.Write([]byte("1"))
+	syncer.Write([]byte("2"))
+	syncer.Write([]byte("3"))
+	stats := syncer.Stats()
+	assert.Equal(t, uint64(2), stats.EntriesBuffered)
+	assert.Equal(t, uint64(1), stats.EntriesDropped)
+	assert.Equal(t, 2, stats.BufferDepth)
+
+	// sent
+	syncer.send()
+	stats = syncer.Stats()
+	assert.Equal(t, uint64(2), stats.EntriesSent)
+	assert.Zero(t, stats.BufferDepth)
+	assert.Equal(t, uint64(1), stats.RequestLatency.Count)
+	assert.Equal(t, uint64(1), stats.RequestLatency.Buckets[10])
+
+	// failed permanently
+	status = http.StatusBadRequest
+	syncer.Write([]byte("4"))
+	syncer.send()
+	stats = syncer.Stats()
+	assert.Equal(t, uint64(2), stats.EntriesSent)
+	assert.Equal(t, uint64(2), stats.EntriesDropped)
+	assert.Equal(t, map[int]uint64{http.StatusBadRequest: 1}, stats.BatchesFailed)
+}
+
+func TestLokiMetrics_observeLatency(t *testing.T) {
+	metrics := newLokiMetrics()
+	metrics.observeLatency(20 * time.Millisecond)
+	metrics.observeLatency(time.Minute)
+
+	assert.Equal(t, uint64(0), metrics.latencyCounts[0])
+	assert.Equal(t, uint64(1), metrics.latencyCounts[2])
+	assert.Equal(t, uint64(1), metrics.latencyCounts[len(lokiLatencyBuckets)-1])
+	assert.Equal(t, uint64(2), metrics.latencyCount)
+	assert.InDelta(t, 60.02, metrics.latencySum, 0.001)
+}
@@ -0,0 +1,49 @@
+package rklogger
+
+// LokiTenantHeader is HTTP header of tenant ID in multi-tenant loki
+const LokiTenantHeader = "X-Scope-OrgID"
+
+// WithLokiTenant provide default tenant ID sent as X-Scope-OrgID header
+func WithLokiTenant(tenant string) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		syncer.tenant = tenant
+	}
+}
+
+// WithLokiCoreTenantField route entries to tenant with value of field, the field is removed from entry,
+// entries without the field are sent to default tenant of LokiSyncer
+func WithLokiCoreTenantField(key string) LokiCoreOption {
+	return func(core *LokiCore) {
+		core.tenantKey = key
+	}
+}
+
+// Returns tenant of value, default tenant is used if value has no tenant
+func (syncer *LokiSyncer) tenantOf(value *lokiValue) string {
+	if len(value.Tenant) > 0 {
+		return value.Tenant
+	}
+
+	return syncer.tenant
+}
+
+// Group values by tenant, order of tenants follows first appearance
+func (syncer *LokiSyncer) groupByTenant(values []*lokiValue) [][]*lokiValue {
+	res := make([][]*lokiValue, 0)
+	index := map[string]int{}
+
+	for i := range values {
+		tenant := syncer.tenantOf(values[i])
+
+		j, ok := index[tenant]
+		if !ok {
+			j = len(res)
+			index[tenant] = j
+			res = append(res, []*lokiValue{})
+		}
+
+		res[j] = append(res[j], values[i])
+	}
+
+	return res
+}
@@ -0,0 +1,74 @@
+package rklogger
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWithLokiTenant(t *testing.T) {
+	// default
+	syncer := NewLokiSyncer()
+	assert.Empty(t, syncer.tenant)
+
+	// with tenant
+	syncer = NewLokiSyncer(WithLokiTenant("ut-tenant"))
+	assert.Equal(t, "ut-tenant", syncer.tenant)
+	assert.Equal(t, "ut-tenant", syncer.tenantOf(&lokiValue{}))
+	assert.Equal(t, "other", syncer.tenantOf(&lokiValue{Tenant: "other"}))
+}
+
+func TestLokiSyncer_groupByTenant(t *testing.T) {
+	syncer := NewLokiSyncer(WithLokiTenant("default"))
+
+	groups := syncer.groupByTenant([]*lokiValue{
+		{Line: "1"},
+		{Line: "2", Tenant: "a"},
+		{Line: "3", Tenant: "default"},
+		{Line: "4", Tenant: "a"},
+	})
+
+	assert.Len(t, groups, 2)
+	assert.Equal(t, "1", groups[0][0].Line)
+	assert.Equal(t, "3", groups[0][1].Line)
+	assert.Equal(t, "2", groups[1][0].Line)
+	assert.Equal(t, "4", groups[1][1].Line)
+}
+
+func TestLokiSyncer_send_WithTenants(t *testing.T) {
+	mutex := sync.Mutex{}
+	received := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		received[r.Header.Get(LokiTenantHeader)] = string(body)
+		mutex.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiTenant("default"))
+	logger := zap.New(NewLokiCore(syncer,
+		zapcore.NewJSONEncoder(zapcore.EncoderConfig{MessageKey: "msg"}),
+		zapcore.InfoLevel,
+		WithLokiCoreTenantField("tenant")))
+
+	logger.Info("to-default")
+	logger.Info("to-team-a", zap.String("tenant", "team-a"))
+	syncer.send()
+
+	assert.Len(t, received, 2)
+	assert.Contains(t, received["default"], "to-default")
+	assert.NotContains(t, received["default"], "to-team-a")
+	assert.Contains(t, received["team-a"], "to-team-a")
+	// tenant field is removed from line
+	assert.NotContains(t, received["team-a"], `\"tenant\"`)
+}
@@ -3,8 +3,12 @@ package rklogger
 import (
 	"context"
 	"crypto/tls"
+	"github.com/rookie-ninja/rk-logger/lokitest"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -13,6 +17,7 @@ func Test_IsValidLabelName(t *testing.T) {
 	assert.False(t, isValidLabelName(""))
 	assert.False(t, isValidLabelName("ut-key"))
 	assert.True(t, isValidLabelName("ut_key"))
+	assert.False(t, isValidLabelName("ut:key"))
 }
 
 func TestNewLokiSyncer(t *testing.T) {
@@ -82,6 +87,326 @@ func TestLokiSyncer_Sync(t *testing.T) {
 	assert.Nil(t, syncer.Sync())
 }
 
+func TestWithLokiHttpTimeout(t *testing.T) {
+	// default
+	syncer := NewLokiSyncer()
+	assert.Equal(t, 10*time.Second, syncer.httpClient.Timeout)
+
+	// with option
+	syncer = NewLokiSyncer(WithLokiHttpTimeout(time.Second))
+	assert.Equal(t, time.Second, syncer.httpClient.Timeout)
+
+	// with invalid option
+	syncer = NewLokiSyncer(WithLokiHttpTimeout(-1))
+	assert.Equal(t, 10*time.Second, syncer.httpClient.Timeout)
+}
+
+func TestLokiSyncer_SyncContext(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	syncer := NewLokiSyncer(WithLokiAddr(strings.TrimPrefix(server.URL, "http://")))
+	syncer.Write([]byte("ut-line"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assert.NotNil(t, syncer.SyncContext(ctx))
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Equal(t, uint64(1), syncer.Stats().EntriesAbandoned)
+	assert.Zero(t, syncer.Stats().EntriesDropped)
+}
+
+func TestLokiSyncer_SyncContext_WithRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiRetryBackoff(time.Minute, time.Minute),
+		WithLokiRetryMaxElapsed(time.Hour))
+	syncer.Write([]byte("ut-line"))
+
+	// backoff is interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	assert.ErrorIs(t, syncer.SyncContext(ctx), context.DeadlineExceeded)
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Equal(t, uint64(1), syncer.Stats().EntriesAbandoned)
+}
+
+func TestLokiSyncer_Interrupt_WithDeadline(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiMaxBatchWaitMs(time.Hour))
+	syncer.Bootstrap(context.TODO())
+	syncer.Write([]byte("1"))
+	syncer.Write([]byte("2"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	syncer.Interrupt(ctx)
+	// no grace period after deadline
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+	assert.Equal(t, uint64(2), syncer.Stats().EntriesAbandoned)
+
+	// interrupt twice
+	syncer.Interrupt(ctx)
+}
+
+func TestLokiSyncer_Interrupt_WithoutBootstrap(t *testing.T) {
+	syncer := NewLokiSyncer()
+	syncer.Interrupt(context.TODO())
+}
+
+func TestLokiSyncer_newLokiStreamList(t *testing.T) {
+	syncer := NewLokiSyncer(WithLokiLabel("app", "ut"))
+
+	now := time.Now()
+	list := syncer.newLokiStreamList([]*lokiValue{
+		{Timestamp: now.Add(time.Second), Line: "second"},
+		{Timestamp: now, Line: "warn", Labels: map[string]string{"level": "warn"}},
+		{Timestamp: now, Line: "first"},
+		{Timestamp: now.Add(2 * time.Second), Line: "third", Labels: map[string]string{"app": "ut"}},
+	})
+
+	assert.Len(t, list.Streams, 2)
+
+	// values without extra labels are grouped together and sorted by timestamp
+	assert.Equal(t, map[string]string{"app": "ut", "rk_logger": "v1"}, list.Streams[0].Stream)
+	assert.Len(t, list.Streams[0].Values, 3)
+	assert.Equal(t, "first", list.Streams[0].Values[0].Line)
+	assert.Equal(t, "second", list.Streams[0].Values[1].Line)
+	assert.Equal(t, "third", list.Streams[0].Values[2].Line)
+
+	assert.Equal(t, map[string]string{"app": "ut", "level": "warn", "rk_logger": "v1"}, list.Streams[1].Stream)
+	assert.Len(t, list.Streams[1].Values, 1)
+}
+
+func TestWithLokiBufferOptions(t *testing.T) {
+	// default
+	syncer := NewLokiSyncer()
+	assert.Equal(t, 100000, syncer.buffer.maxLen)
+	assert.Equal(t, 64*1024*1024, syncer.buffer.maxBytes)
+	assert.Equal(t, LokiOverflowDropNewest, syncer.buffer.policy)
+
+	// with options
+	syncer = NewLokiSyncer(
+		WithLokiMaxBufferSize(10),
+		WithLokiMaxBufferBytes(100),
+		WithLokiOverflowPolicy(LokiOverflowBlock, time.Second))
+	assert.Equal(t, 10, syncer.buffer.maxLen)
+	assert.Equal(t, 100, syncer.buffer.maxBytes)
+	assert.Equal(t, LokiOverflowBlock, syncer.buffer.policy)
+	assert.Equal(t, time.Second, syncer.buffer.blockTimeout)
+
+	// with invalid options
+	syncer = NewLokiSyncer(WithLokiOverflowPolicy(LokiOverflowBlock, 0), WithLokiOverflowPolicy("invalid", 0))
+	assert.Equal(t, LokiOverflowDropNewest, syncer.buffer.policy)
+}
+
+func TestAtomicSlice_add_WithDropNewest(t *testing.T) {
+	a := newAtomicSlice()
+	a.maxLen = 2
+
+	assert.True(t, a.add(&lokiValue{Line: "1"}))
+	assert.True(t, a.add(&lokiValue{Line: "2"}))
+	assert.False(t, a.add(&lokiValue{Line: "3"}))
+	assert.Equal(t, uint64(1), a.dropped)
+
+	values := a.snapshotAndClear()
+	assert.Equal(t, "1", values[0].Line)
+	assert.Equal(t, "2", values[1].Line)
+	assert.Zero(t, a.bytes)
+
+	// limited by bytes
+	a = newAtomicSlice()
+	a.maxBytes = 4
+	assert.True(t, a.add(&lokiValue{Line: "123"}))
+	assert.False(t, a.add(&lokiValue{Line: "45"}))
+	assert.False(t, a.add(&lokiValue{Line: "12345"}))
+	assert.Equal(t, uint64(2), a.dropped)
+}
+
+func TestAtomicSlice_add_WithDropOldest(t *testing.T) {
+	a := newAtomicSlice()
+	a.maxLen = 2
+	a.policy = LokiOverflowDropOldest
+
+	assert.True(t, a.add(&lokiValue{Line: "1"}))
+	assert.True(t, a.add(&lokiValue{Line: "2"}))
+	assert.True(t, a.add(&lokiValue{Line: "3"}))
+	assert.Equal(t, uint64(1), a.dropped)
+	assert.Equal(t, 2, a.bytes)
+
+	values := a.snapshotAndClear()
+	assert.Equal(t, "2", values[0].Line)
+	assert.Equal(t, "3", values[1].Line)
+}
+
+func TestAtomicSlice_offer(t *testing.T) {
+	a := newAtomicSlice()
+	a.maxBytes = 4
+	a.policy = LokiOverflowDropOldest
+
+	added, full := a.offer(&lokiValue{Line: "123"})
+	assert.True(t, added)
+	assert.False(t, full)
+
+	// overflow policy is not applied
+	added, full = a.offer(&lokiValue{Line: "45"})
+	assert.False(t, added)
+	assert.True(t, full)
+	assert.Zero(t, a.dropped)
+	assert.Equal(t, "123", a.snapshotAndClear()[0].Line)
+
+	// never fits
+	added, full = a.offer(&lokiValue{Line: "12345"})
+	assert.False(t, added)
+	assert.False(t, full)
+	assert.Equal(t, uint64(1), a.dropped)
+}
+
+func TestAtomicSlice_add_WithBlock(t *testing.T) {
+	a := newAtomicSlice()
+	a.maxLen = 1
+	a.policy = LokiOverflowBlock
+	a.blockTimeout = 50 * time.Millisecond
+
+	// dropped after timeout
+	assert.True(t, a.add(&lokiValue{Line: "1"}))
+	assert.False(t, a.add(&lokiValue{Line: "2"}))
+	assert.Equal(t, uint64(1), a.dropped)
+
+	// unblocked after flush
+	a.blockTimeout = 10 * time.Second
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		a.snapshotAndClear()
+	}()
+	assert.True(t, a.add(&lokiValue{Line: "3"}))
+	assert.Equal(t, uint64(1), a.dropped)
+	assert.Equal(t, 1, a.len())
+}
+
+func TestLokiSyncer_Dropped(t *testing.T) {
+	syncer := NewLokiSyncer(WithLokiMaxBufferSize(1))
+
+	syncer.Write([]byte("1"))
+	syncer.Write([]byte("2"))
+	assert.Equal(t, uint64(1), syncer.Dropped())
+}
+
+func TestLokiSyncer_batches(t *testing.T) {
+	syncer := NewLokiSyncer(WithLokiMaxBatchSize(2))
+
+	assert.Empty(t, syncer.batches(nil))
+
+	batches := syncer.batches([]*lokiValue{{Line: "1"}, {Line: "2"}, {Line: "3"}})
+	assert.Len(t, batches, 2)
+	assert.Len(t, batches[0], 2)
+	assert.Len(t, batches[1], 1)
+}
+
+func TestLokiSyncer_Bootstrap_FlushOnBatchSize(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiMaxBatchWaitMs(time.Hour),
+		WithLokiMaxBatchSize(2))
+	syncer.Bootstrap(context.TODO())
+	defer syncer.Interrupt(context.TODO())
+
+	syncer.Write([]byte("ut-line-1"))
+	syncer.Write([]byte("ut-line-2"))
+
+	select {
+	case body := <-received:
+		assert.Contains(t, body, "ut-line-1")
+		assert.Contains(t, body, "ut-line-2")
+	case <-time.After(500 * time.Millisecond):
+		assert.Fail(t, "batch is not flushed at batch size")
+	}
+}
+
+func TestLokiSyncer_Bootstrap_FlushOnBatchWait(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(strings.TrimPrefix(server.URL, "http://")),
+		WithLokiMaxBatchWaitMs(50*time.Millisecond))
+	syncer.Bootstrap(context.TODO())
+	defer syncer.Interrupt(context.TODO())
+
+	syncer.Write([]byte("ut-line"))
+
+	select {
+	case body := <-received:
+		assert.Contains(t, body, "ut-line")
+	case <-time.After(time.Second):
+		assert.Fail(t, "batch is not flushed after batch wait")
+	}
+}
+
+func TestLokiSyncer_Interrupt_FlushToLoki(t *testing.T) {
+	server := lokitest.NewServer()
+	defer server.Close()
+
+	syncer := NewLokiSyncer(
+		WithLokiAddr(server.Addr()),
+		WithLokiLabel("app", "ut"),
+		WithLokiMaxBatchWaitMs(time.Hour),
+		WithLokiRetryBackoff(time.Millisecond, time.Millisecond))
+	syncer.Bootstrap(context.TODO())
+
+	// first push fails and is retried
+	server.FailNext(1, http.StatusServiceUnavailable)
+	syncer.Write([]byte("ut-line-1"))
+	syncer.Write([]byte("ut-line-2"))
+	syncer.Interrupt(context.TODO())
+
+	assert.Equal(t, []string{"ut-line-1", "ut-line-2"}, server.Lines())
+	assert.Len(t, server.Streams(map[string]string{"app": "ut", "rk_logger": "v1"}), 1)
+	assert.Len(t, server.Requests(), 2)
+}
+
 func TestAtomicMap(t *testing.T) {
 	m := newAtomicMap()
 
@@ -0,0 +1,106 @@
+package rklogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Layouts of time encoders supported by zap, refer zapcore.ISO8601TimeEncoder and zapcore.RFC3339NanoTimeEncoder
+var lokiTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.000Z0700",
+}
+
+// WithLokiTimeKey parse timestamp of entry from field with key in json encoded line,
+// or from first column of console encoded line, time of Write is used if timestamp is missing or unparsable.
+// Entries written by LokiCore always use time of zapcore.Entry.
+func WithLokiTimeKey(key string) LokiSyncerOption {
+	return func(syncer *LokiSyncer) {
+		syncer.timeKey = key
+	}
+}
+
+// Returns timestamp of encoded entry, fallback to current time
+func (syncer *LokiSyncer) entryTime(p []byte) time.Time {
+	if len(syncer.timeKey) > 0 {
+		if ts, ok := parseLokiEntryTime(p, syncer.timeKey); ok {
+			return ts
+		}
+	}
+
+	return time.Now()
+}
+
+// Parse timestamp from json or console encoded entry
+func parseLokiEntryTime(p []byte, key string) (time.Time, bool) {
+	trimmed := bytes.TrimSpace(p)
+	if len(trimmed) < 1 {
+		return time.Time{}, false
+	}
+
+	// json encoded, find value of time key
+	if trimmed[0] == '{' {
+		needle := []byte(strconv.Quote(key) + ":")
+		idx := bytes.Index(trimmed, needle)
+		if idx < 0 {
+			return time.Time{}, false
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(trimmed[idx+len(needle):]))
+		decoder.UseNumber()
+
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return time.Time{}, false
+		}
+
+		switch v := value.(type) {
+		case string:
+			return parseLokiTimeString(v)
+		case json.Number:
+			return parseLokiTimeString(v.String())
+		}
+
+		return time.Time{}, false
+	}
+
+	// console encoded, time is the first column
+	if idx := bytes.IndexByte(trimmed, '\t'); idx > 0 {
+		trimmed = trimmed[:idx]
+	}
+
+	return parseLokiTimeString(string(trimmed))
+}
+
+// Parse time formatted by zap time encoders, epoch is recognized as seconds, millis, micros or nanos by magnitude
+func parseLokiTimeString(value string) (time.Time, bool) {
+	for i := range lokiTimeLayouts {
+		if ts, err := time.Parse(lokiTimeLayouts[i], value); err == nil {
+			return ts, true
+		}
+	}
+
+	if nanos, err := strconv.ParseInt(value, 10, 64); err == nil && nanos > 1e17 {
+		return time.Unix(0, nanos), true
+	}
+
+	epoch, err := strconv.ParseFloat(value, 64)
+	if err != nil || epoch <= 0 || math.IsInf(epoch, 0) {
+		return time.Time{}, false
+	}
+
+	switch {
+	case epoch < 1e11:
+		sec, frac := math.Modf(epoch)
+		return time.Unix(int64(sec), int64(frac*1e9)), true
+	case epoch < 1e14:
+		return time.Unix(0, int64(epoch*1e6)), true
+	case epoch < 1e17:
+		return time.Unix(0, int64(epoch*1e3)), true
+	default:
+		return time.Unix(0, int64(epoch)), true
+	}
+}
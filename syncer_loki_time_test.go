@@ -0,0 +1,120 @@
+package rklogger
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"testing"
+	"time"
+)
+
+func TestWithLokiTimeKey(t *testing.T) {
+	syncer := NewLokiSyncer(WithLokiTimeKey("ts"))
+	assert.Equal(t, "ts", syncer.timeKey)
+}
+
+func TestParseLokiTimeString(t *testing.T) {
+	expected := time.Unix(1600000000, 123456789)
+
+	// RFC3339Nano
+	ts, ok := parseLokiTimeString(expected.Format(time.RFC3339Nano))
+	assert.True(t, ok)
+	assert.True(t, expected.Equal(ts))
+
+	// ISO8601
+	ts, ok = parseLokiTimeString(expected.Format("2006-01-02T15:04:05.000Z0700"))
+	assert.True(t, ok)
+	assert.True(t, expected.Truncate(time.Millisecond).Equal(ts))
+
+	// epoch nanos
+	ts, ok = parseLokiTimeString("1600000000123456789")
+	assert.True(t, ok)
+	assert.True(t, expected.Equal(ts))
+
+	// epoch micros
+	ts, ok = parseLokiTimeString("1600000000123456")
+	assert.True(t, ok)
+	assert.True(t, expected.Truncate(time.Microsecond).Equal(ts))
+
+	// epoch millis
+	ts, ok = parseLokiTimeString("1600000000123.456")
+	assert.True(t, ok)
+	assert.InDelta(t, expected.UnixNano(), ts.UnixNano(), float64(time.Microsecond))
+
+	// epoch seconds
+	ts, ok = parseLokiTimeString("1600000000.123456")
+	assert.True(t, ok)
+	assert.InDelta(t, expected.UnixNano(), ts.UnixNano(), float64(time.Microsecond))
+
+	// invalid
+	_, ok = parseLokiTimeString("invalid")
+	assert.False(t, ok)
+	_, ok = parseLokiTimeString("-1")
+	assert.False(t, ok)
+}
+
+func TestParseLokiEntryTime(t *testing.T) {
+	expected := time.Unix(1600000000, 123456789)
+	encoderConfig := zapcore.EncoderConfig{
+		TimeKey:    "ts",
+		MessageKey: "msg",
+		EncodeTime: zapcore.RFC3339NanoTimeEncoder,
+	}
+	entry := zapcore.Entry{Time: expected, Message: "ut-msg"}
+
+	// json encoded
+	buf, _ := zapcore.NewJSONEncoder(encoderConfig).EncodeEntry(entry, []zapcore.Field{zap.String("k", "v")})
+	ts, ok := parseLokiEntryTime(buf.Bytes(), "ts")
+	assert.True(t, ok)
+	assert.True(t, expected.Equal(ts))
+
+	// json encoded with epoch nanos
+	encoderConfig.EncodeTime = zapcore.EpochNanosTimeEncoder
+	buf, _ = zapcore.NewJSONEncoder(encoderConfig).EncodeEntry(entry, nil)
+	ts, ok = parseLokiEntryTime(buf.Bytes(), "ts")
+	assert.True(t, ok)
+	assert.True(t, expected.Equal(ts))
+
+	// console encoded
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	buf, _ = zapcore.NewConsoleEncoder(encoderConfig).EncodeEntry(entry, nil)
+	ts, ok = parseLokiEntryTime(buf.Bytes(), "ts")
+	assert.True(t, ok)
+	assert.True(t, expected.Truncate(time.Millisecond).Equal(ts))
+
+	// missing key
+	_, ok = parseLokiEntryTime([]byte(`{"msg":"ut-msg"}`), "ts")
+	assert.False(t, ok)
+
+	// invalid value
+	_, ok = parseLokiEntryTime([]byte(`{"ts":true}`), "ts")
+	assert.False(t, ok)
+
+	// empty
+	_, ok = parseLokiEntryTime([]byte{}, "ts")
+	assert.False(t, ok)
+}
+
+func TestLokiSyncer_Write_WithEntryTime(t *testing.T) {
+	expected := time.Unix(1600000000, 123456789)
+
+	// with time key
+	syncer := NewLokiSyncer(WithLokiTimeKey("ts"))
+	syncer.Write([]byte(`{"ts":"` + expected.Format(time.RFC3339Nano) + `","msg":"ut-msg"}`))
+	values := syncer.buffer.snapshotAndClear()
+	assert.True(t, expected.Equal(values[0].Timestamp))
+
+	// fallback to current time
+	before := time.Now()
+	syncer.Write([]byte(`{"msg":"ut-msg"}`))
+	values = syncer.buffer.snapshotAndClear()
+	assert.False(t, values[0].Timestamp.Before(before))
+
+	// with LokiCore
+	core := NewLokiCore(syncer, zapcore.NewJSONEncoder(zapcore.EncoderConfig{}), zapcore.InfoLevel)
+	assert.Nil(t, core.Write(zapcore.Entry{Time: expected}, nil))
+	assert.Nil(t, core.Write(zapcore.Entry{}, nil))
+	values = syncer.buffer.snapshotAndClear()
+	assert.True(t, expected.Equal(values[0].Timestamp))
+	assert.False(t, values[1].Timestamp.Before(before))
+}
@@ -0,0 +1,523 @@
+package rklogger
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotatingMegabyte = 1024 * 1024
+
+// RotatingSyncerOption options for RotatingSyncer
+type RotatingSyncerOption func(*RotatingSyncer)
+
+// WithRotatingSchedule rotate file on hourly, daily or cron expression like "0 */6 * * *"
+func WithRotatingSchedule(schedule string) RotatingSyncerOption {
+	return func(syncer *RotatingSyncer) {
+		syncer.schedule = schedule
+	}
+}
+
+// WithRotatingMaxSize rotate file once it exceeds size in megabytes, same as MaxSize of lumberjack
+func WithRotatingMaxSize(megabytes int) RotatingSyncerOption {
+	return func(syncer *RotatingSyncer) {
+		if megabytes > 0 {
+			syncer.maxSize = megabytes
+		}
+	}
+}
+
+// WithRotatingMaxAge remove rotated files older than days, same as MaxAge of lumberjack
+func WithRotatingMaxAge(days int) RotatingSyncerOption {
+	return func(syncer *RotatingSyncer) {
+		if days > 0 {
+			syncer.maxAge = days
+		}
+	}
+}
+
+// WithRotatingMaxBackups keep at most number of rotated files, same as MaxBackups of lumberjack
+func WithRotatingMaxBackups(backups int) RotatingSyncerOption {
+	return func(syncer *RotatingSyncer) {
+		if backups > 0 {
+			syncer.maxBackups = backups
+		}
+	}
+}
+
+// WithRotatingLocalTime format filename and compute schedule in local time instead of UTC
+func WithRotatingLocalTime(localTime bool) RotatingSyncerOption {
+	return func(syncer *RotatingSyncer) {
+		syncer.localTime = localTime
+	}
+}
+
+// WithRotatingCompress compress rotated files with gzip
+func WithRotatingCompress(compress bool) RotatingSyncerOption {
+	return func(syncer *RotatingSyncer) {
+		syncer.compress = compress
+	}
+}
+
+// NewRotatingSyncer create RotatingSyncer writes into files named by pattern like logs/app-%Y%m%d.log,
+// supported directives are %Y, %m, %d, %H, %M, %S and %%.
+//
+// Files are rotated on schedule and/or by size, file rotated by size in same period is named
+// with index before extension like logs/app-20240101.1.log. Pattern must have time directive if schedule provided.
+func NewRotatingSyncer(pattern string, opts ...RotatingSyncerOption) (*RotatingSyncer, error) {
+	if len(pattern) < 1 {
+		return nil, errors.New("rotating filename pattern is empty")
+	}
+
+	syncer := &RotatingSyncer{
+		pattern: pattern,
+		now:     time.Now,
+	}
+
+	for i := range opts {
+		opts[i](syncer)
+	}
+
+	if len(syncer.schedule) > 0 {
+		schedule, err := parseRotatingSchedule(syncer.schedule)
+		if err != nil {
+			return nil, err
+		}
+		syncer.boundaries = schedule
+	}
+
+	base, err := formatRotatingPattern(pattern, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	// file of each period must have its own name, otherwise it is rotated by index and pattern is never written again
+	if wildcard, _ := formatRotatingPattern(pattern, time.Time{}, "*"); syncer.boundaries != nil && wildcard == base {
+		return nil, fmt.Errorf("rotating filename pattern %s has no time directive required by schedule %s", pattern, syncer.schedule)
+	}
+
+	syncer.rotated = rotatingPatternRegexp(pattern)
+
+	return syncer, nil
+}
+
+// RotatingSyncer is zapcore.WriteSyncer which rotates file on time schedule and/or by size,
+// retention and compression follow same semantics of lumberjack
+type RotatingSyncer struct {
+	pattern    string
+	rotated    *regexp.Regexp
+	schedule   string
+	boundaries *rotatingSchedule
+	maxSize    int
+	maxAge     int
+	maxBackups int
+	localTime  bool
+	compress   bool
+	now        func() time.Time
+	file       *os.File
+	base       string
+	filename   string
+	size       int64
+	index      int
+	nextRotate time.Time
+	mutex      sync.Mutex
+	millMutex  sync.Mutex
+}
+
+// ************* Implementation of zapcore.WriteSyncer *************
+
+// Write p into current file, file is rotated before writing if boundary passed or size exceeded
+func (syncer *RotatingSyncer) Write(p []byte) (int, error) {
+	syncer.mutex.Lock()
+	defer syncer.mutex.Unlock()
+
+	if max := syncer.maxBytes(); max > 0 && int64(len(p)) > max {
+		return 0, fmt.Errorf("write length %d exceeds maximum file size %d", len(p), max)
+	}
+
+	now := syncer.currentTime()
+	if syncer.file == nil {
+		if err := syncer.open(now, int64(len(p)), ""); err != nil {
+			return 0, err
+		}
+	} else if syncer.shouldRotate(now, int64(len(p))) {
+		if err := syncer.rotate(now, int64(len(p))); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := syncer.file.Write(p)
+	syncer.size += int64(n)
+
+	return n, err
+}
+
+// Sync commits current file to disk
+func (syncer *RotatingSyncer) Sync() error {
+	syncer.mutex.Lock()
+	defer syncer.mutex.Unlock()
+
+	if syncer.file == nil {
+		return nil
+	}
+
+	return syncer.file.Sync()
+}
+
+// Close current file, next write opens file again
+func (syncer *RotatingSyncer) Close() error {
+	syncer.mutex.Lock()
+	defer syncer.mutex.Unlock()
+
+	if syncer.file == nil {
+		return nil
+	}
+
+	err := syncer.file.Close()
+	syncer.file = nil
+
+	return err
+}
+
+// Rotate close current file and open next one immediately
+func (syncer *RotatingSyncer) Rotate() error {
+	syncer.mutex.Lock()
+	defer syncer.mutex.Unlock()
+
+	return syncer.rotate(syncer.currentTime(), 0)
+}
+
+// Filename returns name of current file
+func (syncer *RotatingSyncer) Filename() string {
+	syncer.mutex.Lock()
+	defer syncer.mutex.Unlock()
+
+	return syncer.filename
+}
+
+// Current time in UTC or local time
+func (syncer *RotatingSyncer) currentTime() time.Time {
+	if syncer.localTime {
+		return syncer.now().Local()
+	}
+
+	return syncer.now().UTC()
+}
+
+// Max file size in bytes, zero means unlimited
+func (syncer *RotatingSyncer) maxBytes() int64 {
+	return int64(syncer.maxSize) * rotatingMegabyte
+}
+
+// Returns true if boundary passed or write would exceed max size
+func (syncer *RotatingSyncer) shouldRotate(now time.Time, writeLen int64) bool {
+	if !syncer.nextRotate.IsZero() && !now.Before(syncer.nextRotate) {
+		return true
+	}
+
+	max := syncer.maxBytes()
+	return max > 0 && syncer.size+writeLen > max
+}
+
+// Close current file, open next one and clean up rotated files in background
+func (syncer *RotatingSyncer) rotate(now time.Time, writeLen int64) error {
+	if syncer.file != nil {
+		if err := syncer.file.Close(); err != nil {
+			return err
+		}
+		syncer.file = nil
+	}
+
+	// never reopen file which was just rotated
+	if err := syncer.open(now, writeLen, syncer.filename); err != nil {
+		return err
+	}
+
+	go syncer.mill()
+
+	return nil
+}
+
+// Open file of period which now belongs to, index is increased if file is full or skipped
+func (syncer *RotatingSyncer) open(now time.Time, writeLen int64, skip string) error {
+	base, _ := formatRotatingPattern(syncer.pattern, now)
+
+	index := 0
+	if base == syncer.base {
+		index = syncer.index
+	}
+
+	for ; ; index++ {
+		filename := rotatingIndexedName(base, index)
+		if filename == skip {
+			continue
+		}
+
+		info, err := os.Stat(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		var size int64
+		if err == nil {
+			size = info.Size()
+		}
+
+		if max := syncer.maxBytes(); max > 0 && size > 0 && size+writeLen > max {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+
+		file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+
+		syncer.file = file
+		syncer.base = base
+		syncer.filename = filename
+		syncer.size = size
+		syncer.index = index
+		break
+	}
+
+	if syncer.boundaries != nil {
+		syncer.nextRotate = syncer.boundaries.next(now)
+	} else {
+		syncer.nextRotate = time.Time{}
+	}
+
+	return nil
+}
+
+// Remove rotated files exceed max backups or max age, then compress remaining ones
+func (syncer *RotatingSyncer) mill() {
+	syncer.millMutex.Lock()
+	defer syncer.millMutex.Unlock()
+
+	if syncer.maxBackups < 1 && syncer.maxAge < 1 && !syncer.compress {
+		return
+	}
+
+	files, err := syncer.rotatedFiles()
+	if err != nil {
+		log.Printf("Failed to list rotated files of %s: %v\n", syncer.pattern, err)
+		return
+	}
+
+	// newest first
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+
+	cutoff := syncer.now().Add(-time.Duration(syncer.maxAge) * 24 * time.Hour)
+	remaining := make([]rotatedFile, 0, len(files))
+	for i := range files {
+		if (syncer.maxBackups > 0 && i >= syncer.maxBackups) || (syncer.maxAge > 0 && files[i].modTime.Before(cutoff)) {
+			if err := os.Remove(files[i].path); err != nil {
+				log.Printf("Failed to remove rotated file %s: %v\n", files[i].path, err)
+			}
+			continue
+		}
+		remaining = append(remaining, files[i])
+	}
+
+	if !syncer.compress {
+		return
+	}
+
+	for i := range remaining {
+		if strings.HasSuffix(remaining[i].path, ".gz") {
+			continue
+		}
+
+		if err := compressRotatedFile(remaining[i].path); err != nil {
+			log.Printf("Failed to compress rotated file %s: %v\n", remaining[i].path, err)
+		}
+	}
+}
+
+// Rotated file with modification time
+type rotatedFile struct {
+	path    string
+	modTime time.Time
+}
+
+// Files named by pattern except current one, including indexed and compressed ones. Glob is wider than
+// pattern, like app-%Y%m%d.log matches app-audit-20240101.log, names are checked with regexp of pattern.
+func (syncer *RotatingSyncer) rotatedFiles() ([]rotatedFile, error) {
+	glob, _ := formatRotatingPattern(syncer.pattern, time.Time{}, "*")
+	globs := []string{glob, rotatingIndexedName(glob, -1)}
+
+	syncer.mutex.Lock()
+	current := syncer.filename
+	syncer.mutex.Unlock()
+
+	seen := map[string]struct{}{}
+	res := make([]rotatedFile, 0)
+	for i := range globs {
+		for _, suffix := range []string{"", ".gz"} {
+			matches, err := filepath.Glob(globs[i] + suffix)
+			if err != nil {
+				return nil, err
+			}
+
+			for j := range matches {
+				if _, ok := seen[matches[j]]; ok || matches[j] == current || !syncer.rotated.MatchString(matches[j]) {
+					continue
+				}
+				seen[matches[j]] = struct{}{}
+
+				info, err := os.Stat(matches[j])
+				if err != nil || info.IsDir() {
+					continue
+				}
+				res = append(res, rotatedFile{path: matches[j], modTime: info.ModTime()})
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Compress file into file.gz and remove original one
+func compressRotatedFile(filename string) error {
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(filename+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(filename + ".gz")
+		return err
+	}
+
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(filename + ".gz")
+		return err
+	}
+
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(filename)
+}
+
+// Format pattern with time, directives are replaced with wildcard instead if provided
+func formatRotatingPattern(pattern string, t time.Time, wildcard ...string) (string, error) {
+	builder := strings.Builder{}
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			builder.WriteByte(pattern[i])
+			continue
+		}
+
+		if i+1 >= len(pattern) {
+			return "", fmt.Errorf("invalid rotating filename pattern %s, dangling %%", pattern)
+		}
+		i++
+
+		var value string
+		switch pattern[i] {
+		case 'Y':
+			value = fmt.Sprintf("%04d", t.Year())
+		case 'm':
+			value = fmt.Sprintf("%02d", t.Month())
+		case 'd':
+			value = fmt.Sprintf("%02d", t.Day())
+		case 'H':
+			value = fmt.Sprintf("%02d", t.Hour())
+		case 'M':
+			value = fmt.Sprintf("%02d", t.Minute())
+		case 'S':
+			value = fmt.Sprintf("%02d", t.Second())
+		case '%':
+			builder.WriteByte('%')
+			continue
+		default:
+			return "", fmt.Errorf("invalid rotating filename pattern %s, unsupported directive %%%c", pattern, pattern[i])
+		}
+
+		if len(wildcard) > 0 {
+			value = wildcard[0]
+		}
+		builder.WriteString(value)
+	}
+
+	return builder.String(), nil
+}
+
+// Regexp matches names formatted from pattern with optional index and .gz suffix, directives match digits
+// of their width. Pattern is cleaned like paths returned by filepath.Glob, directives never contain dot, so
+// extension of pattern is extension of formatted name which index is inserted before.
+func rotatingPatternRegexp(pattern string) *regexp.Regexp {
+	pattern = filepath.Clean(pattern)
+	ext := filepath.Ext(pattern)
+
+	expr := "^" + rotatingPatternExpr(strings.TrimSuffix(pattern, ext)) + `(\.[1-9][0-9]*)?` +
+		rotatingPatternExpr(ext) + `(\.gz)?$`
+
+	return regexp.MustCompile(expr)
+}
+
+// Convert validated pattern into regexp source
+func rotatingPatternExpr(pattern string) string {
+	builder := strings.Builder{}
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 >= len(pattern) {
+			builder.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			continue
+		}
+		i++
+
+		switch pattern[i] {
+		case 'Y':
+			builder.WriteString("[0-9]{4}")
+		case '%':
+			builder.WriteString("%")
+		default:
+			builder.WriteString("[0-9]{2}")
+		}
+	}
+
+	return builder.String()
+}
+
+// Insert index before extension, app.log with index 1 is app.1.log, negative index means wildcard
+func rotatingIndexedName(filename string, index int) string {
+	if index == 0 {
+		return filename
+	}
+
+	ext := filepath.Ext(filename)
+	if index < 0 {
+		return strings.TrimSuffix(filename, ext) + ".*" + ext
+	}
+
+	return strings.TrimSuffix(filename, ext) + "." + strconv.Itoa(index) + ext
+}
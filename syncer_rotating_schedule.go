@@ -0,0 +1,164 @@
+package rklogger
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// RotatingHourly rotates file at beginning of every hour
+	RotatingHourly = "hourly"
+	// RotatingDaily rotates file at midnight
+	RotatingDaily = "daily"
+)
+
+// Upper bound of minutes searched for next boundary, covers leap year schedules
+const rotatingScheduleSearchMinutes = 5 * 366 * 24 * 60
+
+// Parse hourly, daily or cron expression with minute, hour, day of month, month and day of week fields,
+// each field supports *, numbers, ranges like 1-5, lists like 1,15 and steps like */6
+func parseRotatingSchedule(schedule string) (*rotatingSchedule, error) {
+	switch schedule {
+	case RotatingHourly:
+		schedule = "0 * * * *"
+	case RotatingDaily:
+		schedule = "0 0 * * *"
+	}
+
+	fields := strings.Fields(schedule)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid rotating schedule %s, expect hourly, daily or cron expression with 5 fields", schedule)
+	}
+
+	res := &rotatingSchedule{
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}
+
+	bounds := []struct {
+		target   *uint64
+		min, max int
+	}{
+		{&res.minute, 0, 59},
+		{&res.hour, 0, 23},
+		{&res.dom, 1, 31},
+		{&res.month, 1, 12},
+		{&res.dow, 0, 7},
+	}
+
+	for i := range bounds {
+		bits, err := parseRotatingScheduleField(fields[i], bounds[i].min, bounds[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rotating schedule %s: %v", schedule, err)
+		}
+		*bounds[i].target = bits
+	}
+
+	// both 0 and 7 are sunday
+	if res.dow&(1<<7) != 0 {
+		res.dow |= 1
+	}
+
+	return res, nil
+}
+
+// Parse comma separated list of field into bit set
+func parseRotatingScheduleField(field string, min, max int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step, stepped := 1, false
+		if idx := strings.IndexByte(part, '/'); idx >= 0 {
+			stepped = true
+			var err error
+			if step, err = strconv.Atoi(part[idx+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %s", part)
+			}
+			part = part[:idx]
+		}
+
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value in %s", field)
+			}
+
+			// 5/10 means from 5 to max with step 10
+			end = start
+			if stepped {
+				end = max
+			}
+			if len(bounds) > 1 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value in %s", field)
+				}
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%s out of range [%d, %d]", field, min, max)
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	if bits == 0 {
+		return 0, errors.New("empty field")
+	}
+
+	return bits, nil
+}
+
+// Cron like schedule of rotating boundaries with minute precision
+type rotatingSchedule struct {
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	domStar bool
+	dowStar bool
+}
+
+// Returns first boundary after t in location of t, zero time is returned if no boundary found
+func (s *rotatingSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+
+	for i := 0; i < rotatingScheduleSearchMinutes; i++ {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// Day matches if both day of month and day of week match, or either matches if both are restricted like cron does
+func (s *rotatingSchedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+
+	return dom || dow
+}
@@ -0,0 +1,76 @@
+package rklogger
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseRotatingSchedule(t *testing.T) {
+	// hourly
+	schedule, err := parseRotatingSchedule(RotatingHourly)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), schedule.minute)
+	assert.True(t, schedule.domStar)
+
+	// with cron expression
+	schedule, err = parseRotatingSchedule("0,30 */6 1-5 * 7")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1|1<<30), schedule.minute)
+	assert.Equal(t, uint64(1|1<<6|1<<12|1<<18), schedule.hour)
+	assert.Equal(t, uint64(0x3e), schedule.dom)
+	assert.Equal(t, uint64(1|1<<7), schedule.dow)
+	assert.False(t, schedule.domStar)
+	assert.False(t, schedule.dowStar)
+
+	// with step from value
+	schedule, err = parseRotatingSchedule("50/5 * * * *")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1<<50|1<<55), schedule.minute)
+
+	// invalid schedules
+	invalid := []string{"", "weekly", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "*/0 * * * *", "a * * * *", "1-a * * * *", "5-1 * * * *"}
+	for i := range invalid {
+		_, err = parseRotatingSchedule(invalid[i])
+		assert.NotNil(t, err, invalid[i])
+	}
+}
+
+func TestRotatingSchedule_next(t *testing.T) {
+	now := time.Date(2024, 1, 31, 10, 20, 30, 0, time.UTC)
+
+	// hourly
+	schedule, _ := parseRotatingSchedule(RotatingHourly)
+	assert.Equal(t, time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC), schedule.next(now))
+
+	// daily
+	schedule, _ = parseRotatingSchedule(RotatingDaily)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), schedule.next(now))
+
+	// every 6 hours
+	schedule, _ = parseRotatingSchedule("0 */6 * * *")
+	assert.Equal(t, time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC), schedule.next(now))
+
+	// on boundary, next one is returned
+	schedule, _ = parseRotatingSchedule(RotatingHourly)
+	assert.Equal(t, time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC),
+		schedule.next(time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC)))
+
+	// day of month or day of week, 2024-02-04 is sunday
+	schedule, _ = parseRotatingSchedule("0 0 15 * 0")
+	assert.Equal(t, time.Date(2024, 2, 4, 0, 0, 0, 0, time.UTC), schedule.next(now))
+
+	// monthly on 29th of february
+	schedule, _ = parseRotatingSchedule("0 0 29 2 *")
+	assert.Equal(t, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), schedule.next(now))
+
+	// never
+	schedule, _ = parseRotatingSchedule("0 0 31 2 *")
+	assert.True(t, schedule.next(now).IsZero())
+
+	// with location
+	loc := time.FixedZone("ut", 5*3600+1800)
+	schedule, _ = parseRotatingSchedule(RotatingDaily)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, loc), schedule.next(now.In(loc)))
+}
@@ -0,0 +1,225 @@
+package rklogger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Fake clock of RotatingSyncer
+type rotatingClock struct {
+	now time.Time
+}
+
+func (clock *rotatingClock) Now() time.Time {
+	return clock.now
+}
+
+func TestNewRotatingSyncer(t *testing.T) {
+	// with defaults
+	syncer, err := NewRotatingSyncer("ut-%Y%m%d.log")
+	assert.Nil(t, err)
+	assert.Nil(t, syncer.boundaries)
+	assert.Zero(t, syncer.maxSize)
+
+	// with options
+	syncer, err = NewRotatingSyncer("ut-%Y%m%d.log",
+		WithRotatingSchedule(RotatingDaily),
+		WithRotatingMaxSize(1),
+		WithRotatingMaxSize(-1),
+		WithRotatingMaxAge(7),
+		WithRotatingMaxBackups(3),
+		WithRotatingLocalTime(true),
+		WithRotatingCompress(true))
+	assert.Nil(t, err)
+	assert.NotNil(t, syncer.boundaries)
+	assert.Equal(t, 1, syncer.maxSize)
+	assert.Equal(t, 7, syncer.maxAge)
+	assert.Equal(t, 3, syncer.maxBackups)
+	assert.True(t, syncer.localTime)
+	assert.True(t, syncer.compress)
+
+	// with invalid pattern or schedule
+	for _, pattern := range []string{"", "ut-%", "ut-%j.log"} {
+		syncer, err = NewRotatingSyncer(pattern)
+		assert.Nil(t, syncer)
+		assert.NotNil(t, err)
+	}
+
+	syncer, err = NewRotatingSyncer("ut.log", WithRotatingSchedule("weekly"))
+	assert.Nil(t, syncer)
+	assert.NotNil(t, err)
+
+	// schedule without time directive
+	syncer, err = NewRotatingSyncer("ut.log", WithRotatingSchedule(RotatingDaily))
+	assert.Nil(t, syncer)
+	assert.NotNil(t, err)
+}
+
+func TestRotatingSyncer_Write_WithSchedule(t *testing.T) {
+	dir := t.TempDir()
+	clock := &rotatingClock{now: time.Date(2024, 1, 31, 23, 59, 0, 0, time.UTC)}
+
+	syncer, err := NewRotatingSyncer(filepath.Join(dir, "app-%Y%m%d.log"), WithRotatingSchedule(RotatingDaily))
+	assert.Nil(t, err)
+	syncer.now = clock.Now
+	defer syncer.Close()
+
+	syncer.Write([]byte("ut-line-1\n"))
+	assert.Equal(t, filepath.Join(dir, "app-20240131.log"), syncer.Filename())
+
+	// cross midnight
+	clock.now = clock.now.Add(time.Minute)
+	syncer.Write([]byte("ut-line-2\n"))
+	assert.Equal(t, filepath.Join(dir, "app-20240201.log"), syncer.Filename())
+	assert.Nil(t, syncer.Sync())
+
+	content, _ := ioutil.ReadFile(filepath.Join(dir, "app-20240131.log"))
+	assert.Equal(t, "ut-line-1\n", string(content))
+	content, _ = ioutil.ReadFile(filepath.Join(dir, "app-20240201.log"))
+	assert.Equal(t, "ut-line-2\n", string(content))
+}
+
+func TestRotatingSyncer_Write_WithSize(t *testing.T) {
+	dir := t.TempDir()
+	clock := &rotatingClock{now: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)}
+
+	syncer, err := NewRotatingSyncer(filepath.Join(dir, "app-%Y%m%d.log"), WithRotatingMaxSize(1))
+	assert.Nil(t, err)
+	syncer.now = clock.Now
+	defer syncer.Close()
+
+	line := []byte(strings.Repeat("a", rotatingMegabyte/2+1))
+	for i := 0; i < 3; i++ {
+		n, err := syncer.Write(line)
+		assert.Nil(t, err)
+		assert.Equal(t, len(line), n)
+	}
+	assert.Equal(t, filepath.Join(dir, "app-20240131.2.log"), syncer.Filename())
+
+	// too large
+	_, err = syncer.Write(make([]byte, rotatingMegabyte+1))
+	assert.NotNil(t, err)
+
+	// reopen after close, full file is skipped
+	assert.Nil(t, syncer.Close())
+	assert.Nil(t, syncer.Close())
+	syncer.base, syncer.index = "", 0
+	syncer.Write(line)
+	assert.Equal(t, filepath.Join(dir, "app-20240131.3.log"), syncer.Filename())
+}
+
+func TestRotatingSyncer_Rotate(t *testing.T) {
+	dir := t.TempDir()
+
+	// pattern without directive
+	syncer, err := NewRotatingSyncer(filepath.Join(dir, "app.log"))
+	assert.Nil(t, err)
+	defer syncer.Close()
+
+	assert.Nil(t, syncer.Sync())
+	syncer.Write([]byte("ut-line-1\n"))
+	assert.Nil(t, syncer.Rotate())
+	syncer.Write([]byte("ut-line-2\n"))
+	assert.Equal(t, filepath.Join(dir, "app.1.log"), syncer.Filename())
+}
+
+func TestRotatingSyncer_mill(t *testing.T) {
+	dir := t.TempDir()
+	clock := &rotatingClock{now: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)}
+
+	syncer, err := NewRotatingSyncer(filepath.Join(dir, "app-%Y%m%d.log"),
+		WithRotatingMaxBackups(2),
+		WithRotatingMaxAge(7),
+		WithRotatingCompress(true))
+	assert.Nil(t, err)
+	syncer.now = clock.Now
+	defer syncer.Close()
+
+	// rotated files with modification time of their date
+	for _, day := range []int{1, 5, 7, 8} {
+		filename := filepath.Join(dir, fmt.Sprintf("app-202401%02d.log", day))
+		assert.Nil(t, ioutil.WriteFile(filename, []byte("ut-line\n"), 0644))
+		modTime := time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC)
+		assert.Nil(t, os.Chtimes(filename, modTime, modTime))
+	}
+	// unrelated file
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "other.log"), []byte("ut"), 0644))
+
+	syncer.Write([]byte("ut-line\n"))
+	syncer.mill()
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"))
+	names := make([]string, 0)
+	for i := range matches {
+		names = append(names, filepath.Base(matches[i]))
+	}
+	assert.ElementsMatch(t, []string{"app-20240110.log", "app-20240107.log.gz", "app-20240108.log.gz", "other.log"}, names)
+
+	// compressed content
+	f, err := os.Open(filepath.Join(dir, "app-20240108.log.gz"))
+	assert.Nil(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	assert.Nil(t, err)
+	content, _ := ioutil.ReadAll(gz)
+	assert.Equal(t, "ut-line\n", string(content))
+}
+
+func TestRotatingSyncer_mill_WithSharedDir(t *testing.T) {
+	dir := t.TempDir()
+
+	syncer, err := NewRotatingSyncer(filepath.Join(dir, "app-%Y%m%d.log"),
+		WithRotatingSchedule("daily"),
+		WithRotatingMaxBackups(1),
+		WithRotatingCompress(true))
+	assert.Nil(t, err)
+	syncer.now = (&rotatingClock{now: time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC)}).Now
+	defer syncer.Close()
+
+	// files of other patterns in same directory
+	others := []string{"app-audit-20200101.log", "app-2020010.log", "app-20200101.x.log", "app-20200101.log.bak"}
+	for i := range others {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, others[i]), []byte("ut"), 0644))
+	}
+	// rotated files of pattern
+	rotated := []string{"app-20200101.log", "app-20200102.1.log", "app-20200103.log.gz"}
+	for i := range rotated {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, rotated[i]), []byte("ut"), 0644))
+		modTime := time.Date(2020, 1, i+1, 0, 0, 0, 0, time.UTC)
+		assert.Nil(t, os.Chtimes(filepath.Join(dir, rotated[i]), modTime, modTime))
+	}
+
+	syncer.Write([]byte("ut-line\n"))
+	assert.Nil(t, syncer.Rotate())
+	syncer.mill()
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"))
+	names := make([]string, 0)
+	for i := range matches {
+		names = append(names, filepath.Base(matches[i]))
+	}
+	// only newest rotated file of pattern is kept
+	assert.ElementsMatch(t, append(others, "app-20200104.1.log", "app-20200104.log.gz"), names)
+}
+
+func TestRotatingPatternRegexp(t *testing.T) {
+	re := rotatingPatternRegexp("logs/./app-%Y%m%d-%H%%.log")
+	assert.True(t, re.MatchString("logs/app-20240101-23%.log"))
+	assert.True(t, re.MatchString("logs/app-20240101-23%.12.log.gz"))
+	assert.False(t, re.MatchString("logs/app-2024011-23%.log"))
+	assert.False(t, re.MatchString("logs/app-2024a101-23%.log"))
+	assert.False(t, re.MatchString("logs/app-20240101-23%.0.log"))
+	assert.False(t, re.MatchString("logs/app-20240101-23%.log.zip"))
+
+	// without extension
+	re = rotatingPatternRegexp("app-%Y")
+	assert.True(t, re.MatchString("app-2024.1"))
+	assert.False(t, re.MatchString("app-2024.log"))
+}
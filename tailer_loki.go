@@ -0,0 +1,528 @@
+package rklogger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// LokiTailerFilenameLabel is label key of file path added by LokiTailer
+	LokiTailerFilenameLabel = "filename"
+	// Files are identified by hash of leading bytes, so that rotated files could be found after rename
+	lokiTailerFingerprintBytes = 1024
+)
+
+// LokiTailerOption options for LokiTailer
+type LokiTailerOption func(*LokiTailer)
+
+// WithLokiTailerFile tail file at path, labels are added to every line besides filename label
+func WithLokiTailerFile(path string, labels map[string]string) LokiTailerOption {
+	return func(tailer *LokiTailer) {
+		tailer.addTarget(path, labels)
+	}
+}
+
+// WithLokiTailerZapConfig tail every file in output paths of zap config, stdout and stderr are ignored
+func WithLokiTailerZapConfig(config *zap.Config, labels map[string]string) LokiTailerOption {
+	return func(tailer *LokiTailer) {
+		if config == nil {
+			return
+		}
+
+		for _, path := range config.OutputPaths {
+			if path == "stdout" || path == "stderr" {
+				continue
+			}
+			tailer.addTarget(path, labels)
+		}
+	}
+}
+
+// WithLokiTailerPositionsFile provide file where read offsets are persisted, tailing resumes from them after restart
+func WithLokiTailerPositionsFile(path string) LokiTailerOption {
+	return func(tailer *LokiTailer) {
+		if len(path) > 0 {
+			tailer.positionsPath = path
+		}
+	}
+}
+
+// WithLokiTailerPollInterval provide interval of checking files for new lines
+func WithLokiTailerPollInterval(interval time.Duration) LokiTailerOption {
+	return func(tailer *LokiTailer) {
+		if interval > 0 {
+			tailer.pollInterval = interval
+		}
+	}
+}
+
+// NewLokiTailer create LokiTailer which ships lines of files into syncer. Files rotated by lumberjack are
+// followed by fingerprint, including compressed backups, so lines written before rotation are not lost.
+func NewLokiTailer(syncer *LokiSyncer, opts ...LokiTailerOption) *LokiTailer {
+	tailer := &LokiTailer{
+		syncer:       syncer,
+		targets:      make([]*lokiTailTarget, 0),
+		pollInterval: time.Second,
+		quitChannel:  make(chan struct{}),
+	}
+
+	for i := range opts {
+		opts[i](tailer)
+	}
+
+	tailer.loadPositions()
+
+	return tailer
+}
+
+// LokiTailer follows log files written by lumberjack and ships new lines to loki, like promtail does
+type LokiTailer struct {
+	syncer        *LokiSyncer
+	targets       []*lokiTailTarget
+	positionsPath string
+	pollInterval  time.Duration
+	saved         []byte
+	quitChannel   chan struct{}
+	quitOnce      sync.Once
+	waitGroup     sync.WaitGroup
+	mutex         sync.Mutex
+}
+
+// File to tail with labels and positions of file and its rotated backups which are not fully read
+type lokiTailTarget struct {
+	path      string
+	labels    map[string]string
+	positions []*lokiTailPosition
+}
+
+// Read offset of file identified by fingerprint
+type lokiTailPosition struct {
+	Fingerprint      string `yaml:"fingerprint"`
+	FingerprintBytes int    `yaml:"fingerprintBytes"`
+	Offset           int64  `yaml:"offset"`
+}
+
+// Content of positions file, keyed by file path
+type lokiTailPositions struct {
+	Positions map[string][]*lokiTailPosition `yaml:"positions"`
+}
+
+// Bootstrap start polling files
+func (tailer *LokiTailer) Bootstrap(context.Context) {
+	tailer.waitGroup.Add(1)
+
+	go func() {
+		ticker := time.NewTicker(tailer.pollInterval)
+
+		defer func() {
+			ticker.Stop()
+			tailer.poll()
+			tailer.waitGroup.Done()
+		}()
+
+		tailer.poll()
+
+		for {
+			select {
+			case <-tailer.quitChannel:
+				return
+			case <-ticker.C:
+				tailer.poll()
+			}
+		}
+	}()
+}
+
+// Interrupt stop polling after reading files once more, lines are shipped into syncer and
+// syncer should be interrupted afterwards
+func (tailer *LokiTailer) Interrupt(ctx context.Context) {
+	tailer.quitOnce.Do(func() {
+		close(tailer.quitChannel)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		tailer.waitGroup.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Interrupt loki tailer before files were read: %s\n", ctx.Err())
+	}
+}
+
+// Add target with absolute path, labels of existing target are overridden
+func (tailer *LokiTailer) addTarget(path string, labels map[string]string) {
+	if len(path) < 1 {
+		return
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		log.Printf("Failed to resolve tailed file %s: %v\n", path, err)
+		return
+	}
+
+	target := &lokiTailTarget{
+		path: abs,
+		labels: map[string]string{
+			LokiTailerFilenameLabel: abs,
+		},
+		positions: make([]*lokiTailPosition, 0),
+	}
+	for k, v := range labels {
+		target.labels[k] = v
+	}
+
+	for i := range tailer.targets {
+		if tailer.targets[i].path == abs {
+			tailer.targets[i] = target
+			return
+		}
+	}
+
+	tailer.targets = append(tailer.targets, target)
+}
+
+// Read new lines of every target and persist positions
+func (tailer *LokiTailer) poll() {
+	tailer.mutex.Lock()
+	defer tailer.mutex.Unlock()
+
+	for i := range tailer.targets {
+		tailer.pollTarget(tailer.targets[i])
+	}
+
+	tailer.savePositions()
+}
+
+// Finish reading rotated files first, then read complete lines of current file
+func (tailer *LokiTailer) pollTarget(target *lokiTailTarget) {
+	current, err := openLokiTailFile(target.path, false)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to open tailed file %s: %v\n", target.path, err)
+		return
+	}
+
+	var currentPos *lokiTailPosition
+	full := false
+	positions := make([]*lokiTailPosition, 0, len(target.positions)+1)
+	for _, pos := range target.positions {
+		if current != nil && currentPos == nil && current.matches(pos) {
+			currentPos = pos
+			continue
+		}
+
+		// keep order of lines, rest of files are read once buffer has room
+		if full {
+			positions = append(positions, pos)
+			continue
+		}
+
+		// file was rotated since last poll
+		backup := tailer.findBackup(target.path, pos)
+		if backup == nil {
+			log.Printf("Rotated file of %s is not found, lines after offset %d are lost\n", target.path, pos.Offset)
+			continue
+		}
+
+		pos.Offset, full, err = tailer.ship(target, backup, pos.Offset, true)
+		if err != nil {
+			// backup may be compressed meanwhile, retry on next poll
+			log.Printf("Failed to read rotated file %s: %v\n", backup.path, err)
+		}
+		if err != nil || full {
+			positions = append(positions, pos)
+		}
+	}
+
+	if current != nil {
+		if currentPos == nil {
+			currentPos = &lokiTailPosition{}
+		}
+
+		// truncated in place
+		if current.size < currentPos.Offset {
+			currentPos.Offset = 0
+		}
+
+		if !full {
+			currentPos.Offset, _, err = tailer.ship(target, current, currentPos.Offset, false)
+			if err != nil {
+				log.Printf("Failed to read tailed file %s: %v\n", current.path, err)
+			}
+		}
+
+		currentPos.FingerprintBytes = len(current.prefix)
+		currentPos.Fingerprint = lokiTailFingerprint(current.prefix)
+		positions = append(positions, currentPos)
+	}
+
+	target.positions = positions
+}
+
+// Ship lines of file from offset, trailing line without line break is shipped only if file is final.
+// Shipping stops before first line rejected by full buffer of syncer and returns true, offset is not
+// advanced beyond lines accepted
+func (tailer *LokiTailer) ship(target *lokiTailTarget, file *lokiTailFile, offset int64, final bool) (int64, bool, error) {
+	reader, err := file.open(offset)
+	if err != nil {
+		return offset, false, err
+	}
+	defer reader.Close()
+
+	buf := bufio.NewReader(reader)
+	for {
+		line, err := buf.ReadBytes('\n')
+		if err == io.EOF {
+			if final && len(line) > 0 {
+				if !tailer.add(target, line) {
+					return offset, true, nil
+				}
+				offset += int64(len(line))
+			}
+			return offset, false, nil
+		}
+
+		if err != nil {
+			return offset, false, err
+		}
+
+		if !tailer.add(target, line) {
+			return offset, true, nil
+		}
+		offset += int64(len(line))
+	}
+}
+
+// Add line into syncer with labels of target, returns false if buffer of syncer is full
+func (tailer *LokiTailer) add(target *lokiTailTarget, line []byte) bool {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) < 1 {
+		return true
+	}
+
+	return tailer.syncer.offer(&lokiValue{
+		Timestamp: tailer.syncer.entryTime(line),
+		Line:      string(line),
+		Labels:    target.labels,
+	})
+}
+
+// Find backup of lumberjack with fingerprint of position, uncompressed backup is preferred since
+// compressed one may be still in writing
+//
+// Lumberjack names backup as <name>-<timestamp><ext>, with .gz suffix if compressed
+func (tailer *LokiTailer) findBackup(path string, pos *lokiTailPosition) *lokiTailFile {
+	dir := filepath.Dir(path)
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(filepath.Base(path), ext) + "-"
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0)
+	for i := range infos {
+		name := infos[i].Name()
+		if infos[i].IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if strings.HasSuffix(name, ext) || strings.HasSuffix(name, ext+".gz") {
+			names = append(names, name)
+		}
+	}
+	// newest first, plain file sorts before its compressed one
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	sort.SliceStable(names, func(i, j int) bool {
+		return !strings.HasSuffix(names[i], ".gz") && strings.HasSuffix(names[j], ".gz")
+	})
+
+	for i := range names {
+		file, err := openLokiTailFile(filepath.Join(dir, names[i]), strings.HasSuffix(names[i], ".gz"))
+		if err == nil && file != nil && file.matches(pos) {
+			return file
+		}
+	}
+
+	return nil
+}
+
+// Assign persisted positions to targets
+func (tailer *LokiTailer) loadPositions() {
+	if len(tailer.positionsPath) < 1 {
+		return
+	}
+
+	content, err := ioutil.ReadFile(tailer.positionsPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read loki tailer positions %s: %v\n", tailer.positionsPath, err)
+		}
+		return
+	}
+
+	positions := &lokiTailPositions{}
+	if err := yaml.Unmarshal(content, positions); err != nil {
+		log.Printf("Failed to parse loki tailer positions %s: %v\n", tailer.positionsPath, err)
+		return
+	}
+
+	for i := range tailer.targets {
+		if pos, ok := positions.Positions[tailer.targets[i].path]; ok {
+			tailer.targets[i].positions = pos
+		}
+	}
+	tailer.saved = content
+}
+
+// Persist positions if changed, file is replaced atomically
+func (tailer *LokiTailer) savePositions() {
+	if len(tailer.positionsPath) < 1 {
+		return
+	}
+
+	positions := &lokiTailPositions{
+		Positions: make(map[string][]*lokiTailPosition),
+	}
+	for i := range tailer.targets {
+		positions.Positions[tailer.targets[i].path] = tailer.targets[i].positions
+	}
+
+	content, err := yaml.Marshal(positions)
+	if err != nil || string(content) == string(tailer.saved) {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(tailer.positionsPath), 0755); err != nil {
+		log.Printf("Failed to create loki tailer positions dir: %v\n", err)
+		return
+	}
+
+	tmp := tailer.positionsPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, content, 0644); err != nil {
+		log.Printf("Failed to write loki tailer positions %s: %v\n", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, tailer.positionsPath); err != nil {
+		log.Printf("Failed to write loki tailer positions %s: %v\n", tailer.positionsPath, err)
+		return
+	}
+
+	tailer.saved = content
+}
+
+// Open file and read leading bytes as fingerprint, returns nil if file is empty
+func openLokiTailFile(path string, compressed bool) (*lokiTailFile, error) {
+	file := &lokiTailFile{
+		path:       path,
+		compressed: compressed,
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	file.size = info.Size()
+
+	reader, err := file.open(0)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	file.prefix = make([]byte, lokiTailerFingerprintBytes)
+	n, err := io.ReadFull(reader, file.prefix)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	file.prefix = file.prefix[:n]
+
+	if n < 1 {
+		return nil, nil
+	}
+
+	return file, nil
+}
+
+// Tailed file or its rotated backup
+type lokiTailFile struct {
+	path       string
+	compressed bool
+	size       int64
+	prefix     []byte
+}
+
+// Returns true if fingerprint of position is computed from same leading bytes
+func (file *lokiTailFile) matches(pos *lokiTailPosition) bool {
+	if pos.FingerprintBytes < 1 || pos.FingerprintBytes > len(file.prefix) {
+		return false
+	}
+
+	return lokiTailFingerprint(file.prefix[:pos.FingerprintBytes]) == pos.Fingerprint
+}
+
+// Open reader at offset of decompressed content
+func (file *lokiTailFile) open(offset int64) (io.ReadCloser, error) {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !file.compressed {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if _, err := io.CopyN(ioutil.Discard, gz, offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &lokiTailGzipReader{Reader: gz, file: f}, nil
+}
+
+// Closes underlying file of gzip reader
+type lokiTailGzipReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (r *lokiTailGzipReader) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
+
+// Hex encoded sha256 of bytes
+func lokiTailFingerprint(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,284 @@
+package rklogger
+
+import (
+	"context"
+	"fmt"
+	"github.com/rookie-ninja/rk-logger/lokitest"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Lines buffered in syncer, buffer is cleared
+func tailedLines(syncer *LokiSyncer) []string {
+	res := make([]string, 0)
+	for _, value := range syncer.buffer.snapshotAndClear() {
+		res = append(res, value.Line)
+	}
+
+	return res
+}
+
+// Append content to file
+func appendFile(t *testing.T, path, content string) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString(content)
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+}
+
+func TestNewLokiTailer(t *testing.T) {
+	syncer := NewLokiSyncer()
+
+	// with defaults
+	tailer := NewLokiTailer(syncer)
+	assert.Equal(t, syncer, tailer.syncer)
+	assert.Empty(t, tailer.targets)
+	assert.Equal(t, time.Second, tailer.pollInterval)
+
+	// with options
+	tailer = NewLokiTailer(syncer,
+		WithLokiTailerFile("ut.log", map[string]string{"app": "ut"}),
+		WithLokiTailerFile("", nil),
+		WithLokiTailerZapConfig(&zap.Config{OutputPaths: []string{"stdout", "ut.log", "ut-2.log"}}, nil),
+		WithLokiTailerZapConfig(nil, nil),
+		WithLokiTailerPositionsFile("ut-positions.yaml"),
+		WithLokiTailerPollInterval(time.Minute),
+		WithLokiTailerPollInterval(-1))
+	abs, _ := filepath.Abs("ut.log")
+	assert.Len(t, tailer.targets, 2)
+	assert.Equal(t, abs, tailer.targets[0].path)
+	// labels are overridden by later option
+	assert.Equal(t, map[string]string{LokiTailerFilenameLabel: abs}, tailer.targets[0].labels)
+	assert.Equal(t, "ut-positions.yaml", tailer.positionsPath)
+	assert.Equal(t, time.Minute, tailer.pollInterval)
+}
+
+func TestLokiTailer_poll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ut.log")
+	syncer := NewLokiSyncer()
+	tailer := NewLokiTailer(syncer, WithLokiTailerFile(path, map[string]string{"app": "ut"}))
+
+	// file not exist
+	tailer.poll()
+	assert.Empty(t, tailedLines(syncer))
+
+	// partial line is kept
+	appendFile(t, path, "ut-line-1\nut-line-2\r\n\nut-li")
+	tailer.poll()
+	values := syncer.buffer.snapshotAndClear()
+	assert.Len(t, values, 2)
+	assert.Equal(t, "ut-line-1", values[0].Line)
+	assert.Equal(t, "ut-line-2", values[1].Line)
+	assert.Equal(t, map[string]string{LokiTailerFilenameLabel: path, "app": "ut"}, values[0].Labels)
+
+	appendFile(t, path, "ne-3\n")
+	tailer.poll()
+	assert.Equal(t, []string{"ut-line-3"}, tailedLines(syncer))
+
+	// nothing new
+	tailer.poll()
+	assert.Empty(t, tailedLines(syncer))
+
+	// truncated in place
+	assert.Nil(t, ioutil.WriteFile(path, []byte("ut-\n"), 0644))
+	tailer.poll()
+	assert.Equal(t, []string{"ut-"}, tailedLines(syncer))
+}
+
+func TestLokiTailer_poll_WithRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ut.log")
+	writer := &lumberjack.Logger{Filename: path}
+	defer writer.Close()
+
+	syncer := NewLokiSyncer()
+	tailer := NewLokiTailer(syncer, WithLokiTailerFile(path, nil))
+
+	writer.Write([]byte("ut-line-1\n"))
+	tailer.poll()
+	assert.Equal(t, []string{"ut-line-1"}, tailedLines(syncer))
+
+	// lines written before and after rotation
+	writer.Write([]byte("ut-line-2\n"))
+	assert.Nil(t, writer.Rotate())
+	writer.Write([]byte("ut-line-3\n"))
+	tailer.poll()
+	assert.Equal(t, []string{"ut-line-2", "ut-line-3"}, tailedLines(syncer))
+
+	// rotated file is not read again
+	writer.Write([]byte("ut-line-4\n"))
+	tailer.poll()
+	assert.Equal(t, []string{"ut-line-4"}, tailedLines(syncer))
+	assert.Len(t, tailer.targets[0].positions, 1)
+}
+
+func TestLokiTailer_poll_WithCompressedBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ut.log")
+	writer := &lumberjack.Logger{Filename: path, Compress: true}
+	defer writer.Close()
+
+	syncer := NewLokiSyncer()
+	tailer := NewLokiTailer(syncer, WithLokiTailerFile(path, nil))
+
+	writer.Write([]byte("ut-line-1\n"))
+	tailer.poll()
+	assert.Equal(t, []string{"ut-line-1"}, tailedLines(syncer))
+
+	writer.Write([]byte("ut-line-2\n"))
+	assert.Nil(t, writer.Rotate())
+
+	// wait for lumberjack to compress backup
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		matches, _ := filepath.Glob(filepath.Join(dir, "ut-*.log"))
+		compressed, _ := filepath.Glob(filepath.Join(dir, "ut-*.log.gz"))
+		if len(matches) < 1 && len(compressed) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			assert.FailNow(t, "backup is not compressed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tailer.poll()
+	assert.Equal(t, []string{"ut-line-2"}, tailedLines(syncer))
+}
+
+func TestLokiTailer_poll_WithLostBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ut.log")
+	syncer := NewLokiSyncer()
+	tailer := NewLokiTailer(syncer, WithLokiTailerFile(path, nil))
+
+	appendFile(t, path, "ut-line-1\n")
+	tailer.poll()
+	assert.Equal(t, []string{"ut-line-1"}, tailedLines(syncer))
+
+	// removed without backup
+	assert.Nil(t, os.Remove(path))
+	appendFile(t, path, "ut-line-2\n")
+	tailer.poll()
+	assert.Equal(t, []string{"ut-line-2"}, tailedLines(syncer))
+	assert.Len(t, tailer.targets[0].positions, 1)
+}
+
+func TestLokiTailer_poll_WithFullBuffer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ut.log")
+	positionsPath := filepath.Join(dir, "positions.yaml")
+
+	syncer := NewLokiSyncer(WithLokiMaxBufferSize(10))
+	tailer := NewLokiTailer(syncer, WithLokiTailerFile(path, nil), WithLokiTailerPositionsFile(positionsPath))
+
+	for i := 0; i < 50; i++ {
+		appendFile(t, path, fmt.Sprintf("ut-line-%02d\n", i))
+	}
+
+	// stops at first line rejected, rest is read on next poll
+	lines := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		tailer.poll()
+		polled := tailedLines(syncer)
+		assert.Len(t, polled, 10)
+		lines = append(lines, polled...)
+
+		content, err := ioutil.ReadFile(positionsPath)
+		assert.Nil(t, err)
+		assert.Contains(t, string(content), fmt.Sprintf("offset: %d", (i+1)*110))
+	}
+
+	assert.Equal(t, "ut-line-00", lines[0])
+	assert.Equal(t, "ut-line-49", lines[49])
+	assert.Zero(t, syncer.Dropped())
+
+	// rotated file is finished before current one
+	writer := &lumberjack.Logger{Filename: path}
+	defer writer.Close()
+	for i := 50; i < 65; i++ {
+		writer.Write([]byte(fmt.Sprintf("ut-line-%02d\n", i)))
+	}
+	assert.Nil(t, writer.Rotate())
+	writer.Write([]byte("ut-line-65\n"))
+
+	tailer.poll()
+	lines = tailedLines(syncer)
+	assert.Len(t, lines, 10)
+	assert.Equal(t, "ut-line-50", lines[0])
+	assert.Len(t, tailer.targets[0].positions, 2)
+
+	tailer.poll()
+	lines = tailedLines(syncer)
+	assert.Len(t, lines, 6)
+	assert.Equal(t, "ut-line-60", lines[0])
+	assert.Equal(t, "ut-line-65", lines[5])
+	assert.Len(t, tailer.targets[0].positions, 1)
+}
+
+func TestLokiTailer_positions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ut.log")
+	positionsPath := filepath.Join(dir, "positions", "positions.yaml")
+
+	syncer := NewLokiSyncer()
+	tailer := NewLokiTailer(syncer, WithLokiTailerFile(path, nil), WithLokiTailerPositionsFile(positionsPath))
+
+	appendFile(t, path, "ut-line-1\n")
+	tailer.poll()
+	assert.Equal(t, []string{"ut-line-1"}, tailedLines(syncer))
+
+	content, err := ioutil.ReadFile(positionsPath)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(content), "offset: 10"))
+
+	// resume after restart
+	appendFile(t, path, "ut-line-2\n")
+	tailer = NewLokiTailer(syncer, WithLokiTailerFile(path, nil), WithLokiTailerPositionsFile(positionsPath))
+	tailer.poll()
+	assert.Equal(t, []string{"ut-line-2"}, tailedLines(syncer))
+
+	// invalid positions file is ignored
+	assert.Nil(t, ioutil.WriteFile(positionsPath, []byte("ut-invalid"), 0644))
+	tailer = NewLokiTailer(syncer, WithLokiTailerFile(path, nil), WithLokiTailerPositionsFile(positionsPath))
+	tailer.poll()
+	assert.Equal(t, []string{"ut-line-1", "ut-line-2"}, tailedLines(syncer))
+}
+
+func TestLokiTailer_Bootstrap(t *testing.T) {
+	server := lokitest.NewServer()
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "ut.log")
+	logger, err := NewZapLoggerWithConf(&zap.Config{
+		Level:         zap.NewAtomicLevelAt(zap.InfoLevel),
+		Encoding:      "json",
+		EncoderConfig: zap.NewProductionEncoderConfig(),
+		OutputPaths:   []string{path},
+	}, &lumberjack.Logger{})
+	assert.Nil(t, err)
+
+	syncer := NewLokiSyncer(WithLokiAddr(server.Addr()), WithLokiTimeKey("ts"))
+	tailer := NewLokiTailer(syncer,
+		WithLokiTailerFile(path, map[string]string{"app": "ut"}),
+		WithLokiTailerPollInterval(10*time.Millisecond))
+	syncer.Bootstrap(context.TODO())
+	tailer.Bootstrap(context.TODO())
+
+	logger.Info("ut-message")
+	logger.Sync()
+
+	tailer.Interrupt(context.TODO())
+	syncer.Interrupt(context.TODO())
+
+	streams := server.Streams(map[string]string{LokiTailerFilenameLabel: path, "app": "ut"})
+	assert.Len(t, streams, 1)
+	assert.Len(t, streams[0].Entries, 1)
+	assert.Contains(t, streams[0].Entries[0].Line, "ut-message")
+}